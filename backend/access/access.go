@@ -0,0 +1,125 @@
+package access
+
+import (
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+)
+
+// Roles, each one includes the permissions of the previous
+const (
+	RoleViewer = "viewer" // Read the statistics of the site
+	RoleEditor = "editor" // Also change the settings and goals of the site
+	RoleAdmin  = "admin"  // Also manage the members of the site
+)
+
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether role grants at least the permissions of required.
+func HasRole(role, required string) bool {
+	return roleRank[role] >= roleRank[required] && role != ""
+}
+
+// IsSuperuser reports whether the user may access every site.
+func IsSuperuser(userId uint) bool {
+	var user structs.User
+	if err := database.Session.Select("superuser").First(&user, userId).Error; err != nil {
+		return false
+	}
+	return user.Superuser
+}
+
+// SiteRole returns the highest role of a user on a site, granted either
+// directly or through the organization of the site. It returns "" for no access.
+func SiteRole(userId uint, site string) (string, error) {
+	if IsSuperuser(userId) {
+		return RoleAdmin, nil
+	}
+
+	var roles []string
+	err := database.Session.Raw(`
+		SELECT sm.role FROM site_members sm
+		JOIN sites s ON s.id = sm.site_id
+		WHERE s.name = ? AND sm.user_id = ?
+		UNION ALL
+		SELECT om.role FROM organization_members om
+		JOIN sites s ON s.organization_id = om.organization_id
+		WHERE s.name = ? AND om.user_id = ?
+	`, site, userId, site, userId).Scan(&roles).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to query site role: %w", err)
+	}
+
+	best := ""
+	for _, role := range roles {
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best, nil
+}
+
+// VisibleSites returns the sites a user can see with their roles. all is true
+// for superusers, who are not limited to the returned list.
+func VisibleSites(userId uint) (sites []structs.SiteAccess, all bool, err error) {
+	if IsSuperuser(userId) {
+		err = database.Session.Raw(`SELECT name AS site, ? AS role FROM sites ORDER BY name`, RoleAdmin).Scan(&sites).Error
+		return sites, true, err
+	}
+
+	var rows []structs.SiteAccess
+	err = database.Session.Raw(`
+		SELECT s.name AS site, sm.role FROM site_members sm
+		JOIN sites s ON s.id = sm.site_id
+		WHERE sm.user_id = ?
+		UNION ALL
+		SELECT s.name AS site, om.role FROM organization_members om
+		JOIN sites s ON s.organization_id = om.organization_id
+		WHERE om.user_id = ?
+	`, userId, userId).Scan(&rows).Error
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query visible sites: %w", err)
+	}
+
+	// Keep the highest role per site
+	index := make(map[string]int)
+	for _, row := range rows {
+		if i, ok := index[row.Site]; ok {
+			if roleRank[row.Role] > roleRank[sites[i].Role] {
+				sites[i].Role = row.Role
+			}
+			continue
+		}
+		index[row.Site] = len(sites)
+		sites = append(sites, row)
+	}
+	return sites, false, nil
+}
+
+// OrganizationRole returns the role of a user in an organization, "" for none.
+// Superusers are admins of every organization.
+func OrganizationRole(userId, organizationId uint) (string, error) {
+	if IsSuperuser(userId) {
+		return RoleAdmin, nil
+	}
+
+	var member structs.OrganizationMember
+	err := database.Session.
+		Where("organization_id = ? AND user_id = ?", organizationId, userId).
+		Limit(1).
+		Find(&member).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to query organization role: %w", err)
+	}
+	return member.Role, nil
+}
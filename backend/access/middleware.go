@@ -0,0 +1,98 @@
+package access
+
+import (
+	"log"
+	"net/http"
+	"statistics/auth"
+	"statistics/structs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// visibleSitesKey is the gin context key holding the sites of an "all sites" request.
+const visibleSitesKey = "visibleSites"
+
+// SiteParam returns the site a statistics request is about: the site query
+// parameter, or page, which names the site on the older routes.
+func SiteParam(c *gin.Context) string {
+	if site := c.Query("site"); site != "" {
+		return site
+	}
+	return c.Query("page")
+}
+
+// Middleware enforces viewer access on statistics routes. A request for one
+// site, see SiteParam, needs at least the viewer role on it. A request for all
+// sites is scoped to the sites the caller may see, see Sites.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := auth.UserId(c)
+
+		if site := SiteParam(c); site != "" {
+			role, err := SiteRole(userId, site)
+			if err != nil {
+				log.Println("Error checking site access:", err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if !HasRole(role, RoleViewer) {
+				c.AbortWithStatusJSON(http.StatusForbidden, structs.APIError{Error: "No access to this site", Code: structs.ErrorCodeForbidden, Parameter: "site"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		visible, all, err := VisibleSites(userId)
+		if err != nil {
+			log.Println("Error checking site access:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !all {
+			names := make([]string, 0, len(visible))
+			for _, site := range visible {
+				names = append(names, site.Site)
+			}
+			c.Set(visibleSitesKey, names)
+		}
+		c.Next()
+	}
+}
+
+// RequireSiteRole rejects requests whose user lacks role on the site named by the :site path parameter.
+func RequireSiteRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteRole, err := SiteRole(auth.UserId(c), c.Param("site"))
+		if err != nil {
+			log.Println("Error checking site access:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !HasRole(siteRole, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The " + role + " role is required on this site"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSuperuser rejects requests of users who are not superusers.
+func RequireSuperuser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsSuperuser(auth.UserId(c)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Superuser access is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Sites returns the sites an "all sites" request is limited to, nil when the
+// caller may see every site.
+func Sites(c *gin.Context) []string {
+	if sites, ok := c.Get(visibleSitesKey); ok {
+		return sites.([]string)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package acquisition
+
+import (
+	"net/url"
+	"statistics/structs"
+	"strings"
+)
+
+// utmParameters lists the campaign parameters in the order they are stored.
+var utmParameters = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// NormalizeSource reduces a referrer URL to its source domain: lowercase host
+// without port and leading "www.". It returns "" for empty or unparsable input.
+func NormalizeSource(referrer string) string {
+	referrer = strings.TrimSpace(referrer)
+	if referrer == "" {
+		return ""
+	}
+	if !strings.Contains(referrer, "://") {
+		referrer = "http://" + referrer
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return strings.TrimPrefix(host, "www.")
+}
+
+// Apply fills the referrer and UTM fields of a page view. Campaign parameters
+// are read from params first and from the query string of the page URL second.
+// Referrals from the tracked site itself are treated as direct traffic.
+func Apply(record *structs.WebMetric, referrer string, params url.Values) {
+	source := NormalizeSource(referrer)
+	if source != "" && source != NormalizeSource(record.Site) {
+		trimmed := truncate(strings.TrimSpace(referrer), 2048)
+		record.Referrer = &trimmed
+		record.ReferrerSource = &source
+	}
+
+	pageParams := url.Values{}
+	if index := strings.Index(record.Page, "?"); index >= 0 {
+		pageParams, _ = url.ParseQuery(record.Page[index+1:])
+	}
+
+	values := make([]*string, len(utmParameters))
+	for i, name := range utmParameters {
+		value := strings.TrimSpace(params.Get(name))
+		if value == "" {
+			value = strings.TrimSpace(pageParams.Get(name))
+		}
+		if value != "" {
+			value = truncate(strings.ToLower(value), 255)
+			values[i] = &value
+		}
+	}
+	record.UtmSource, record.UtmMedium, record.UtmCampaign, record.UtmTerm, record.UtmContent =
+		values[0], values[1], values[2], values[3], values[4]
+}
+
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return value[:length]
+	}
+	return value
+}
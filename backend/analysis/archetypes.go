@@ -5,6 +5,7 @@ import (
 	"math"
 	"sort"
 	"statistics/database"
+	"statistics/statistics"
 	"statistics/structs"
 	"time"
 )
@@ -26,7 +27,7 @@ type sessionFeature struct {
 }
 
 // getSessionFeatures queries and calculates behavioral features for all sessions in a given timeframe.
-func getSessionFeatures(site string, from, to time.Time) ([]sessionFeature, error) {
+func getSessionFeatures(scope statistics.Scope) ([]sessionFeature, error) {
 	type rawSessionData struct {
 		SessionID       string
 		StartTime       time.Time
@@ -37,22 +38,27 @@ func getSessionFeatures(site string, from, to time.Time) ([]sessionFeature, erro
 
 	var rawData []rawSessionData
 
-	dbQuery := database.Session.
-		Model(&structs.WebMetric{}).
-		Select(`
+	var err error
+	if where, params, ok := scope.SessionWhere(); ok {
+		err = database.Session.
+			Model(&structs.Session{}).
+			Select("id::text AS session_id, started_at AS start_time, ended_at AS end_time, page_count, unique_pages AS unique_page_count").
+			Where(where, params...).
+			Find(&rawData).Error
+	} else {
+		hits, params := scope.SessionHits()
+		dbQuery := database.Session.
+			Table(hits, params...).
+			Select(`
             session_id,
             MIN(timestamp) as start_time,
             MAX(timestamp) as end_time,
             COUNT(*) as page_count,
             COUNT(DISTINCT page) as unique_page_count
-        `).
-		Where("timestamp BETWEEN ? AND ?", from, to)
+        `)
 
-	if site != "" {
-		dbQuery = dbQuery.Where("site = ?", site)
+		err = dbQuery.Group("session_id").Find(&rawData).Error
 	}
-
-	err := dbQuery.Group("session_id").Find(&rawData).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to query session data: %w", err)
 	}
@@ -106,8 +112,8 @@ func classifySession(feature sessionFeature) string {
 }
 
 // GetArchetypes is the main function to generate behavioral archetypes from session data.
-func GetArchetypes(site string, from, to time.Time) ([]structs.Archetype, error) {
-	sessionFeatures, err := getSessionFeatures(site, from, to)
+func GetArchetypes(scope statistics.Scope) ([]structs.Archetype, error) {
+	sessionFeatures, err := getSessionFeatures(scope)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"statistics/config"
+	"statistics/database"
+	"statistics/structs"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Token types, stored in the "typ" claim so a refresh token cannot be used as an access token
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+	tokenTypeStream  = "stream"
+)
+
+// ErrInvalidCredentials is returned for an unknown user or a wrong password.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrInvalidToken is returned for malformed, expired or wrongly typed tokens.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the JWT claims issued by the backend. The subject is the user ID.
+type Claims struct {
+	Type string `json:"typ"`
+	Site string `json:"site,omitempty"` // Of a stream token
+	jwt.RegisteredClaims
+}
+
+var (
+	dummyHash       []byte // Compared against for unknown users
+	signingKey      []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	streamTokenTTL  time.Duration
+)
+
+// Init reads the signing key and token lifetimes from the environment and
+// creates the initial user when the user table is empty:
+//
+//	JWT_SECRET           HMAC signing key, a random one is generated when unset
+//	JWT_ACCESS_TTL       access token lifetime (default 15m)
+//	JWT_REFRESH_TTL      refresh token lifetime (default 168h)
+//	JWT_STREAM_TTL       stream token lifetime (default 1m)
+//	ADMIN_USERNAME       initial user, created on first start
+//	ADMIN_PASSWORD       password of the initial user
+func Init() error {
+	signingKey = []byte(os.Getenv("JWT_SECRET"))
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			return fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		log.Println("WARNING: JWT_SECRET is not set, tokens are signed with a random key and become invalid on restart")
+	}
+
+	accessTokenTTL = config.Duration("JWT_ACCESS_TTL", 15*time.Minute)
+	refreshTokenTTL = config.Duration("JWT_REFRESH_TTL", 7*24*time.Hour)
+	streamTokenTTL = config.Duration("JWT_STREAM_TTL", time.Minute)
+
+	var err error
+	dummyHash, err = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return bootstrapUser(os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD"))
+}
+
+// bootstrapUser creates the first user as a superuser, so a fresh install can
+// log in. Installs from before roles existed get their oldest user promoted.
+func bootstrapUser(username, password string) error {
+	var count int64
+	if err := database.Session.Model(&structs.User{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count users: %w", err)
+	}
+	if count > 0 {
+		return ensureSuperuser()
+	}
+	if username == "" || password == "" {
+		log.Println("WARNING: No users exist, set ADMIN_USERNAME and ADMIN_PASSWORD to create one")
+		return nil
+	}
+
+	if _, err := CreateUser(username, password, true); err != nil {
+		return err
+	}
+	log.Println("Created initial user:", username)
+	return nil
+}
+
+// ensureSuperuser promotes the oldest user when no superuser exists.
+func ensureSuperuser() error {
+	var count int64
+	if err := database.Session.Model(&structs.User{}).Where("superuser = ?", true).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count superusers: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var user structs.User
+	if err := database.Session.Order("id").First(&user).Error; err != nil {
+		return fmt.Errorf("failed to find the oldest user: %w", err)
+	}
+	if err := database.Session.Model(&user).Update("superuser", true).Error; err != nil {
+		return fmt.Errorf("failed to promote user: %w", err)
+	}
+	log.Println("Promoted user to superuser:", user.Username)
+	return nil
+}
+
+// CreateUser stores a new user with a bcrypt hash of the password.
+func CreateUser(username, password string, superuser bool) (*structs.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := structs.User{Username: username, PasswordHash: string(hash), Superuser: superuser}
+	if err := database.Session.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &user, nil
+}
+
+// Login checks the credentials and issues a token pair.
+func Login(username, password string) (*structs.TokenResponse, error) {
+	var user structs.User
+	err := database.Session.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Compare anyway, so unknown users take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return issueTokens(user.Id)
+}
+
+// Refresh exchanges a valid refresh token for a new token pair. The user must still exist.
+func Refresh(refreshToken string) (*structs.TokenResponse, error) {
+	claims, err := parseToken(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var user structs.User
+	if err := database.Session.First(&user, userId).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	return issueTokens(user.Id)
+}
+
+// ValidateAccessToken returns the ID of the user an access token was issued to.
+func ValidateAccessToken(token string) (uint, error) {
+	claims, err := parseToken(token, tokenTypeAccess)
+	if err != nil {
+		return 0, err
+	}
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return uint(userId), nil
+}
+
+// IssueStreamToken issues a short-lived token opening the live stream of a
+// site, passed in the URL by clients that cannot send headers (EventSource).
+func IssueStreamToken(userId uint, site string) (*structs.StreamTokenResponse, error) {
+	token, err := signToken(userId, tokenTypeStream, streamTokenTTL, site)
+	if err != nil {
+		return nil, err
+	}
+	return &structs.StreamTokenResponse{Token: token, ExpiresIn: int(streamTokenTTL.Seconds())}, nil
+}
+
+// ValidateStreamToken returns the ID of the user a stream token of site was issued to.
+func ValidateStreamToken(token, site string) (uint, error) {
+	claims, err := parseToken(token, tokenTypeStream)
+	if err != nil || claims.Site != site {
+		return 0, ErrInvalidToken
+	}
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return uint(userId), nil
+}
+
+func issueTokens(userId uint) (*structs.TokenResponse, error) {
+	accessToken, err := signToken(userId, tokenTypeAccess, accessTokenTTL, "")
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := signToken(userId, tokenTypeRefresh, refreshTokenTTL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &structs.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func signToken(userId uint, tokenType string, ttl time.Duration, site string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Type: tokenType,
+		Site: site,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(userId), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+func parseToken(token, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return signingKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Type != tokenType {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
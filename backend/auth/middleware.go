@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"statistics/structs"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userIdKey is the gin context key holding the authenticated user's ID.
+const userIdKey = "userId"
+
+// Middleware rejects requests without a valid "Authorization: Bearer" access token.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="statistics"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		userId, err := ValidateAccessToken(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="statistics", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(userIdKey, userId)
+		c.Next()
+	}
+}
+
+// StreamMiddleware authenticates a stream by the token query parameter, a
+// stream token of the site query parameter, see IssueStreamToken. Without it
+// the bearer token is required like on the other routes.
+func StreamMiddleware() gin.HandlerFunc {
+	bearer := Middleware()
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			bearer(c)
+			return
+		}
+
+		userId, err := ValidateStreamToken(token, c.Query("site"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(userIdKey, userId)
+		c.Next()
+	}
+}
+
+// UserId returns the ID of the authenticated user of the request.
+func UserId(c *gin.Context) uint {
+	return c.GetUint(userIdKey)
+}
+
+// LoginHandler issues a token pair for a username and password.
+func LoginHandler(c *gin.Context) {
+	var request structs.LoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == "" || request.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+
+	tokens, err := Login(request.Username, request.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error logging in:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair.
+func RefreshHandler(c *gin.Context) {
+	var request structs.RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	tokens, err := Refresh(request.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
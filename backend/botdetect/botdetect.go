@@ -0,0 +1,154 @@
+package botdetect
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"os"
+	"statistics/useragent"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons reported by Check
+const (
+	ReasonUserAgent  = "user-agent"
+	ReasonDatacenter = "datacenter"
+	ReasonHitRate    = "hit-rate"
+)
+
+const (
+	hitRateWindow   = 10 * time.Second // Sliding window for the behavioral check
+	maxHitsInWindow = 20               // More page views than this within the window is not a human
+	sessionTTL      = 30 * time.Minute // How long per-session state is kept after the last hit
+)
+
+type sessionState struct {
+	hits    []time.Time
+	flagged bool
+	seen    time.Time
+}
+
+var (
+	rangesMu         sync.RWMutex
+	datacenterRanges []*net.IPNet
+
+	sessionsMu  sync.Mutex
+	sessions    = make(map[string]*sessionState)
+	lastCleanup time.Time
+)
+
+// LoadDatacenterRanges reads CIDR ranges, one per line, from a local file.
+// Empty lines and lines starting with # are ignored.
+func LoadDatacenterRanges(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var ranges []*net.IPNet
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			if strings.Contains(line, ":") {
+				line += "/128"
+			} else {
+				line += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(line)
+		if err != nil {
+			log.Printf("WARNING: Skipping invalid datacenter range %q: %v", line, err)
+			continue
+		}
+		ranges = append(ranges, network)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	rangesMu.Lock()
+	datacenterRanges = ranges
+	rangesMu.Unlock()
+	log.Printf("Loaded %d datacenter IP ranges from: %s", len(ranges), path)
+	return nil
+}
+
+// Check classifies a page view. It returns true and the reason when the hit
+// comes from a bot, based on the user agent, the client IP and the hit rate
+// of the session. The hit rate counts the requests as they are received, not
+// the client timestamps of buffered page views. A session caught by the hit
+// rate check stays flagged.
+func Check(ip string, client useragent.Info, sessionId string) (bool, string) {
+	if client.Device == useragent.DeviceBot {
+		return true, ReasonUserAgent
+	}
+	if isDatacenterIP(ip) {
+		return true, ReasonDatacenter
+	}
+	if sessionId != "" && exceedsHitRate(sessionId, time.Now()) {
+		return true, ReasonHitRate
+	}
+	return false, ""
+}
+
+func isDatacenterIP(ipStr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return false
+	}
+
+	rangesMu.RLock()
+	defer rangesMu.RUnlock()
+	for _, network := range datacenterRanges {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func exceedsHitRate(sessionId string, now time.Time) bool {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if now.Sub(lastCleanup) > time.Minute {
+		for id, state := range sessions {
+			if now.Sub(state.seen) > sessionTTL {
+				delete(sessions, id)
+			}
+		}
+		lastCleanup = now
+	}
+
+	state, ok := sessions[sessionId]
+	if !ok {
+		state = &sessionState{}
+		sessions[sessionId] = state
+	}
+	state.seen = now
+	if state.flagged {
+		return true
+	}
+
+	// Keep only the hits inside the window ending at this hit
+	kept := state.hits[:0]
+	for _, hit := range state.hits {
+		if now.Sub(hit) < hitRateWindow {
+			kept = append(kept, hit)
+		}
+	}
+	state.hits = append(kept, now)
+
+	if len(state.hits) > maxHitsInWindow {
+		state.flagged = true
+		state.hits = nil
+	}
+	return state.flagged
+}
@@ -0,0 +1,95 @@
+package botdetect
+
+import (
+	"os"
+	"path/filepath"
+	"statistics/useragent"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datacenters.txt")
+	ranges := "# Test ranges\n\n203.0.113.0/24\n198.51.100.7\n2001:db8::/32\nnot-a-range\n"
+	if err := os.WriteFile(path, []byte(ranges), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDatacenterRanges(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { datacenterRanges = nil })
+
+	browser := useragent.Info{Browser: "Firefox", OS: "Linux", Device: useragent.DeviceDesktop}
+	bot := useragent.Info{Browser: "Bot", OS: "Unknown", Device: useragent.DeviceBot}
+
+	tests := []struct {
+		name       string
+		ip         string
+		client     useragent.Info
+		wantBot    bool
+		wantReason string
+	}{
+		{name: "browser", ip: "192.0.2.1", client: browser},
+		{name: "bot user agent", ip: "192.0.2.1", client: bot, wantBot: true, wantReason: ReasonUserAgent},
+		{name: "user agent comes first", ip: "203.0.113.5", client: bot, wantBot: true, wantReason: ReasonUserAgent},
+		{name: "datacenter range", ip: "203.0.113.5", client: browser, wantBot: true, wantReason: ReasonDatacenter},
+		{name: "single datacenter address", ip: "198.51.100.7", client: browser, wantBot: true, wantReason: ReasonDatacenter},
+		{name: "next to a single address", ip: "198.51.100.8", client: browser},
+		{name: "IPv6 datacenter range", ip: "2001:db8::1", client: browser, wantBot: true, wantReason: ReasonDatacenter},
+		{name: "IPv6 outside the ranges", ip: "2001:db9::1", client: browser},
+		{name: "address with spaces", ip: " 203.0.113.5 ", client: browser, wantBot: true, wantReason: ReasonDatacenter},
+		{name: "unparsable address", ip: "unknown", client: browser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a session the hit rate is not checked
+			isBot, reason := Check(tt.ip, tt.client, "")
+			if isBot != tt.wantBot || reason != tt.wantReason {
+				t.Errorf("Check(%q) = %t, %q, want %t, %q", tt.ip, isBot, reason, tt.wantBot, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestExceedsHitRate(t *testing.T) {
+	start := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval time.Duration // Between two hits
+		hits     int
+		want     bool
+	}{
+		{name: "at the limit", interval: 100 * time.Millisecond, hits: maxHitsInWindow, want: false},
+		{name: "over the limit", interval: 100 * time.Millisecond, hits: maxHitsInWindow + 1, want: true},
+		{name: "spread over the window", interval: hitRateWindow / maxHitsInWindow, hits: 3 * maxHitsInWindow, want: false},
+		{name: "hits at the same time", interval: 0, hits: maxHitsInWindow + 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionId := "session-" + tt.name
+			var got bool
+			for i := 0; i < tt.hits; i++ {
+				got = exceedsHitRate(sessionId, start.Add(time.Duration(i)*tt.interval))
+			}
+			if got != tt.want {
+				t.Errorf("exceedsHitRate() after %d hits = %t, want %t", tt.hits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExceedsHitRateStaysFlagged(t *testing.T) {
+	start := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	for i := 0; i <= maxHitsInWindow; i++ {
+		exceedsHitRate("flagged", start)
+	}
+	if !exceedsHitRate("flagged", start.Add(sessionTTL-time.Second)) {
+		t.Error("a flagged session was cleared within the session TTL")
+	}
+	if exceedsHitRate("other", start) {
+		t.Error("a single hit of another session was flagged")
+	}
+}
@@ -0,0 +1,41 @@
+// Package config reads the settings of the backend from the environment. An
+// unset variable takes the default, an invalid one is logged and takes the
+// default as well.
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// String returns the value of key, or defaultValue when it is empty.
+func String(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns the positive integer of key.
+func Int(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid value for %s: %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// Duration returns the positive duration of key, e.g. "30s".
+func Duration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("WARNING: Invalid value for %s: %q, using %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
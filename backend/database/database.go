@@ -2,8 +2,8 @@ package database
 
 import (
 	"fmt"
-	"os"
-	"statistics/structs"
+	"statistics/config"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -11,13 +11,18 @@ import (
 
 var Session *gorm.DB
 
+// Reports runs the queries of the statistics reports. Its connections have a
+// statement_timeout (DB_REPORT_TIMEOUT, 30s by default), so a costly filter
+// expression cannot keep the database busy.
+var Reports *gorm.DB
+
 func DatabaseInitSession() error {
-	host := getEnv("DB_HOST", "timescaledb")
-	user := getEnv("DB_USER", "root")
-	password := getEnv("DB_PASSWORD", "12345")
-	dbname := getEnv("DB_NAME", "statistics")
-	port := getEnv("DB_PORT", "5432")
-	sslmode := getEnv("DB_SSLMODE", "disable")
+	host := config.String("DB_HOST", "timescaledb")
+	user := config.String("DB_USER", "root")
+	password := config.String("DB_PASSWORD", "12345")
+	dbname := config.String("DB_NAME", "statistics")
+	port := config.String("DB_PORT", "5432")
+	sslmode := config.String("DB_SSLMODE", "disable")
 
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		host, user, password, dbname, port, sslmode)
@@ -27,19 +32,24 @@ func DatabaseInitSession() error {
 		return err
 	}
 
-	Session = db
-
-	err = db.AutoMigrate(&structs.WebMetric{})
+	timeout := config.Duration("DB_REPORT_TIMEOUT", 30*time.Second)
+	reports, err := gorm.Open(postgres.Open(fmt.Sprintf("%s statement_timeout=%d", dsn, timeout.Milliseconds())), &gorm.Config{})
 	if err != nil {
 		return err
 	}
 
+	Session = db
+	Reports = reports
 	return nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Setup applies the settings that are configuration rather than schema, once
+// the migrations are applied: the compression and retention policies of
+// web_metrics and how the rollups are stored.
+func Setup() error {
+	timescale, err := setupTimescale(Session)
+	if err != nil {
+		return err
 	}
-	return defaultValue
+	return setupRollups(Session, timescale)
 }
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Storage of the rollups, see RollupStorage.
+const (
+	RollupContinuous = "continuous"
+	RollupTable      = "table"
+)
+
+// Rollup counts the sessions of the sessions table by start time in buckets
+// of a fixed width, per site, entry page and country: sessions, page views
+// and bounces. Buckets are aligned to UTC.
+type Rollup struct {
+	Table string
+	Unit  string // Of date_trunc
+	Width time.Duration
+}
+
+// Rollups lists the rollups, widest first.
+var Rollups = []Rollup{
+	{Table: "traffic_daily", Unit: "day", Width: 24 * time.Hour},
+	{Table: "traffic_hourly", Unit: "hour", Width: time.Hour},
+}
+
+var rollupStorage string
+
+func rollupTables() []string {
+	tables := make([]string, len(Rollups))
+	for i, rollup := range Rollups {
+		tables[i] = rollup.Table
+	}
+	return tables
+}
+
+// RollupStorage reports how the rollups are stored: RollupContinuous for
+// continuous aggregates of TimescaleDB, RollupTable for tables the sessions
+// job maintains, or "" before Setup.
+func RollupStorage() string {
+	return rollupStorage
+}
+
+// rollupColumns are the aggregates of a rollup over sessions.
+const rollupColumns = `site, entry_page, country_code,
+	COUNT(*) AS sessions,
+	SUM(page_count) AS page_views,
+	COUNT(*) FILTER (WHERE bounce) AS bounces`
+
+// setupRollups finds out how migration 0003_rollups stored the rollups.
+func setupRollups(db *gorm.DB, timescale bool) error {
+	if timescale {
+		var continuous bool
+		if err := db.Raw("SELECT EXISTS (SELECT 1 FROM timescaledb_information.continuous_aggregates WHERE view_name = ?)", Rollups[0].Table).Scan(&continuous).Error; err != nil {
+			return fmt.Errorf("failed to look up the rollups: %w", err)
+		}
+		if continuous {
+			rollupStorage = RollupContinuous
+			return nil
+		}
+	}
+
+	var exists bool
+	if err := db.Raw("SELECT to_regclass(?) IS NOT NULL", Rollups[0].Table).Scan(&exists).Error; err != nil {
+		return fmt.Errorf("failed to look up the rollups: %w", err)
+	}
+	if exists {
+		rollupStorage = RollupTable
+	}
+	return nil
+}
+
+// RollupQuery aggregates the sessions matching where into the buckets of
+// rollup, the rows of the plain rollup tables. Migration 0003_rollups defines
+// the same rows.
+func RollupQuery(rollup Rollup, where string) string {
+	return `
+		SELECT date_trunc('` + rollup.Unit + `', started_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket, ` + rollupColumns + `
+		FROM sessions
+		WHERE ` + where + `
+		GROUP BY 1, site, entry_page, country_code`
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"statistics/config"
+	"statistics/structs"
+
+	"gorm.io/gorm"
+)
+
+// setupTimescale brings the compression and retention policies of the
+// web_metrics hypertable in line with DB_COMPRESS_AFTER (default 7 days) and
+// DB_RETENTION (default none, raw page views are kept forever). Both take a
+// Postgres interval such as "30 days". Policies are only replaced when
+// changed, so it runs on each start. It reports false when web_metrics is a
+// plain table, see migration 0002_hypertables.
+func setupTimescale(db *gorm.DB) (bool, error) {
+	var installed bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&installed).Error; err != nil {
+		return false, fmt.Errorf("failed to look up TimescaleDB: %w", err)
+	}
+	if !installed {
+		log.Println("WARNING: TimescaleDB is not available, web_metrics is a plain table")
+		return false, nil
+	}
+	hypertable, err := isHypertable(db, "web_metrics")
+	if err != nil || !hypertable {
+		return false, err
+	}
+
+	var compressed bool
+	if err := db.Raw("SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = 'web_metrics'").Scan(&compressed).Error; err != nil {
+		return true, fmt.Errorf("failed to read the compression settings of web_metrics: %w", err)
+	}
+	compressAfter := ""
+	if compressed {
+		compressAfter = config.String("DB_COMPRESS_AFTER", "7 days")
+	}
+	if err := setPolicy(db, "policy_compression", "compress_after", "add_compression_policy", "remove_compression_policy", compressAfter); err != nil {
+		return true, err
+	}
+	retention := config.String("DB_RETENTION", "")
+	if err := setPolicy(db, "policy_retention", "drop_after", "add_retention_policy", "remove_retention_policy", retention); err != nil {
+		return true, err
+	}
+
+	if compressAfter == "" {
+		compressAfter = "none"
+	}
+	if retention == "" {
+		retention = "none"
+	}
+	log.Printf("web_metrics is a hypertable (compress after: %s, retention: %s)", compressAfter, retention)
+	return true, nil
+}
+
+func isHypertable(db *gorm.DB, table string) (bool, error) {
+	var hypertable bool
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = ?)", table).Scan(&hypertable).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the %s hypertable: %w", table, err)
+	}
+	return hypertable, nil
+}
+
+// setPolicy replaces the policy job of web_metrics running proc when its
+// interval setting differs from interval. An empty interval removes the policy.
+func setPolicy(db *gorm.DB, proc, setting, add, remove, interval string) error {
+	var current struct {
+		Found bool
+		Same  bool
+	}
+	query := `
+		SELECT COUNT(*) > 0 AS found, COALESCE(BOOL_AND((config->>?)::interval = NULLIF(?, '')::interval), FALSE) AS same
+		FROM timescaledb_information.jobs
+		WHERE proc_name = ? AND hypertable_name = 'web_metrics'`
+	if err := db.Raw(query, setting, interval, proc).Scan(&current).Error; err != nil {
+		return fmt.Errorf("failed to read %s of web_metrics: %w", proc, err)
+	}
+	if current.Same || (!current.Found && interval == "") {
+		return nil
+	}
+
+	if current.Found {
+		if err := db.Exec("SELECT " + remove + "('web_metrics', if_exists => TRUE)").Error; err != nil {
+			return fmt.Errorf("failed to remove %s of web_metrics: %w", proc, err)
+		}
+	}
+	if interval != "" {
+		if err := db.Exec("SELECT "+add+"('web_metrics', ?::interval)", interval).Error; err != nil {
+			return fmt.Errorf("failed to add %s of web_metrics: %w", proc, err)
+		}
+	}
+	return nil
+}
+
+// StorageStatus reports whether web_metrics is a hypertable, its chunks,
+// size, indexes and the state of its compression and retention policies, and
+// how the rollups are stored and refreshed.
+func StorageStatus() (structs.StorageStatus, error) {
+	status := structs.StorageStatus{Rollups: RollupStorage(), Indexes: []string{}, Jobs: []structs.StorageJob{}}
+
+	if err := Session.Raw("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'").Scan(&status.Version).Error; err != nil {
+		return status, fmt.Errorf("failed to read the TimescaleDB version: %w", err)
+	}
+	status.Timescale = status.Version != ""
+
+	if err := Session.Raw("SELECT indexname FROM pg_indexes WHERE tablename = 'web_metrics' ORDER BY indexname").Scan(&status.Indexes).Error; err != nil {
+		return status, fmt.Errorf("failed to list the indexes of web_metrics: %w", err)
+	}
+
+	if status.Timescale {
+		hypertable, err := isHypertable(Session, "web_metrics")
+		if err != nil {
+			return status, err
+		}
+		status.Hypertable = hypertable
+	}
+	if !status.Hypertable {
+		if err := Session.Raw("SELECT pg_total_relation_size('web_metrics')").Scan(&status.TotalBytes).Error; err != nil {
+			return status, fmt.Errorf("failed to read the size of web_metrics: %w", err)
+		}
+		return status, nil
+	}
+
+	var chunks struct {
+		Chunks           int
+		CompressedChunks int
+	}
+	err := Session.Raw(`
+		SELECT COUNT(*) AS chunks, COUNT(*) FILTER (WHERE is_compressed) AS compressed_chunks
+		FROM timescaledb_information.chunks
+		WHERE hypertable_name = 'web_metrics'`).Scan(&chunks).Error
+	if err != nil {
+		return status, fmt.Errorf("failed to count the chunks of web_metrics: %w", err)
+	}
+	status.Chunks, status.CompressedChunks = chunks.Chunks, chunks.CompressedChunks
+
+	if err := Session.Raw("SELECT hypertable_size('web_metrics')").Scan(&status.TotalBytes).Error; err != nil {
+		return status, fmt.Errorf("failed to read the size of web_metrics: %w", err)
+	}
+	var sizes struct {
+		Before *int64
+		After  *int64
+	}
+	err = Session.Raw(`
+		SELECT before_compression_total_bytes AS before, after_compression_total_bytes AS after
+		FROM hypertable_compression_stats('web_metrics')`).Scan(&sizes).Error
+	if err != nil {
+		return status, fmt.Errorf("failed to read the compression stats of web_metrics: %w", err)
+	}
+	status.UncompressedBytes, status.CompressedBytes = sizes.Before, sizes.After
+
+	var jobs []struct {
+		structs.StorageJob
+		Config *string
+	}
+	err = Session.Raw(`
+		SELECT
+			jobs.job_id AS id,
+			jobs.proc_name AS kind,
+			COALESCE(continuous_aggregates.view_name, jobs.hypertable_name) AS target,
+			COALESCE(jobs.config->>'compress_after', jobs.config->>'drop_after') AS config,
+			job_stats.last_run_status,
+			job_stats.last_run_started_at AS last_run_at,
+			job_stats.next_start AS next_start_at,
+			COALESCE(job_stats.total_failures, 0) AS total_failures
+		FROM timescaledb_information.jobs
+		LEFT JOIN timescaledb_information.job_stats ON job_stats.job_id = jobs.job_id
+		LEFT JOIN timescaledb_information.continuous_aggregates
+			ON continuous_aggregates.materialization_hypertable_schema = jobs.hypertable_schema
+			AND continuous_aggregates.materialization_hypertable_name = jobs.hypertable_name
+		WHERE jobs.hypertable_name = 'web_metrics' OR continuous_aggregates.view_name IN ?
+		ORDER BY jobs.job_id`, rollupTables()).Scan(&jobs).Error
+	if err != nil {
+		return status, fmt.Errorf("failed to read the policy jobs of web_metrics: %w", err)
+	}
+	for _, job := range jobs {
+		if job.Target != "web_metrics" {
+			status.Jobs = append(status.Jobs, job.StorageJob)
+			continue
+		}
+		switch job.Kind {
+		case "policy_compression":
+			status.CompressAfter = job.Config
+		case "policy_retention":
+			status.Retention = job.Config
+		}
+		status.Jobs = append(status.Jobs, job.StorageJob)
+	}
+	return status, nil
+}
+
+// DecompressSite decompresses the compressed chunks of web_metrics holding
+// page views of site, so they can be updated or deleted within tx. TimescaleDB
+// supports UPDATE and DELETE on compressed chunks from 2.11 on, with older
+// versions the compression policy compresses the chunks again later.
+func DecompressSite(tx *gorm.DB, site string) error {
+	var version string
+	if err := tx.Raw("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'").Scan(&version).Error; err != nil {
+		return fmt.Errorf("failed to read the TimescaleDB version: %w", err)
+	}
+	if version == "" {
+		return nil
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return fmt.Errorf("failed to parse the TimescaleDB version %q: %w", version, err)
+	}
+	if major > 2 || (major == 2 && minor >= 11) {
+		return nil
+	}
+
+	// Segmented by site, the time range of the site is read from the
+	// metadata of the compressed chunks
+	err := tx.Exec(`
+		WITH span AS (SELECT MIN(timestamp) AS first, MAX(timestamp) AS last FROM web_metrics WHERE site = ?)
+		SELECT decompress_chunk(format('%I.%I', chunks.chunk_schema, chunks.chunk_name)::regclass, if_compressed => TRUE)
+		FROM timescaledb_information.chunks, span
+		WHERE chunks.hypertable_name = 'web_metrics' AND chunks.is_compressed
+			AND chunks.range_end > span.first AND chunks.range_start <= span.last`, site).Error
+	if err != nil {
+		return fmt.Errorf("failed to decompress the chunks of %s: %w", site, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package goals stores the conversion goals of the sites.
+package goals
+
+import (
+	"errors"
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of goals
+const (
+	KindPage     = "page"     // A page matching the pattern was visited
+	KindEvent    = "event"    // A custom event matching the pattern fired
+	KindDuration = "duration" // The session lasted at least Duration minutes
+)
+
+// maxDuration is the longest duration goal, a day.
+const maxDuration = 24 * 60
+
+// maxLength is the length of the name and pattern columns.
+const maxLength = 255
+
+// Apply validates a goal request and copies it into goal.
+func Apply(goal *structs.Goal, req structs.GoalRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return errors.New("missing goal name")
+	}
+	if utf8.RuneCountInString(name) > maxLength {
+		return fmt.Errorf("goal name must be at most %d characters", maxLength)
+	}
+
+	pattern := strings.TrimSpace(req.Pattern)
+	switch req.Kind {
+	case KindPage, KindEvent:
+		if pattern == "" {
+			return fmt.Errorf("missing pattern for %s goal", req.Kind)
+		}
+		if utf8.RuneCountInString(pattern) > maxLength {
+			return fmt.Errorf("pattern must be at most %d characters", maxLength)
+		}
+		req.Duration = 0
+	case KindDuration:
+		if req.Duration <= 0 || req.Duration > maxDuration {
+			return fmt.Errorf("duration must be between 1 and %d minutes", maxDuration)
+		}
+		pattern = ""
+	default:
+		return errors.New("invalid goal kind, use page, event or duration")
+	}
+
+	goal.Name, goal.Kind, goal.Pattern, goal.Duration = name, req.Kind, pattern, req.Duration
+	return nil
+}
+
+// ForSite returns the goals of a site by name, oldest first.
+func ForSite(site string) ([]structs.Goal, error) {
+	var goals []structs.Goal
+	err := database.Session.
+		Joins("JOIN sites ON sites.id = goals.site_id").
+		Where("sites.name = ?", site).
+		Order("goals.id ASC").
+		Find(&goals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch goals: %w", err)
+	}
+	return goals, nil
+}
@@ -0,0 +1,275 @@
+package ingest
+
+import (
+	"errors"
+	"log"
+	"statistics/config"
+	"statistics/database"
+	"statistics/live"
+	"statistics/prometheus"
+	"statistics/structs"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrQueueFull is returned when the buffer cannot take more records; callers should answer with 503.
+var ErrQueueFull = errors.New("ingest queue is full")
+
+// ErrNotRunning is returned when records are enqueued before Start or after Close.
+var ErrNotRunning = errors.New("ingest writer is not running")
+
+// Writer buffers WebMetric records in memory and writes them to the database in batches.
+type Writer struct {
+	queueSize     int
+	flushSize     int
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	buffer  []structs.WebMetric
+	running bool
+
+	flushNow chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var writer *Writer
+
+// Start creates the global writer from the environment and starts its flush loop.
+func Start() {
+	writer = &Writer{
+		queueSize:     config.Int("INGEST_QUEUE_SIZE", 10000),
+		flushSize:     config.Int("INGEST_FLUSH_SIZE", 500),
+		flushInterval: config.Duration("INGEST_FLUSH_INTERVAL", time.Second),
+		flushNow:      make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		running:       true,
+	}
+	go writer.loop()
+	log.Printf("Ingest writer started (queue: %d, flush size: %d, flush interval: %s)",
+		writer.queueSize, writer.flushSize, writer.flushInterval)
+}
+
+// Enqueue adds records to the buffer. Either all records are accepted or none.
+func Enqueue(records ...structs.WebMetric) error {
+	if writer == nil {
+		return ErrNotRunning
+	}
+	return writer.enqueue(records)
+}
+
+// Close stops accepting records and writes everything still buffered.
+func Close() {
+	if writer == nil {
+		return
+	}
+	writer.mu.Lock()
+	if !writer.running {
+		writer.mu.Unlock()
+		return
+	}
+	writer.running = false
+	writer.mu.Unlock()
+
+	close(writer.stop)
+	<-writer.done
+	log.Println("Ingest writer drained")
+}
+
+func (w *Writer) enqueue(records []structs.WebMetric) error {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return ErrNotRunning
+	}
+	if len(w.buffer)+len(records) > w.queueSize {
+		w.mu.Unlock()
+		prometheus.IncIngestQueueFull()
+		return ErrQueueFull
+	}
+	for i := range records {
+		sanitize(&records[i])
+	}
+	w.buffer = append(w.buffer, records...)
+	depth := len(w.buffer)
+	// Reported under the lock, so a concurrent flush cannot be overwritten
+	// by an older depth
+	prometheus.SetIngestQueueDepth(depth)
+	w.mu.Unlock()
+
+	live.Publish(records...)
+
+	if depth >= w.flushSize {
+		select {
+		case w.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.flushNow:
+			w.flush()
+		case <-w.stop:
+			w.flush()
+			return
+		}
+	}
+}
+
+// flush takes the whole buffer and writes it in chunks of flushSize rows.
+func (w *Writer) flush() {
+	w.mu.Lock()
+	records := w.buffer
+	w.buffer = nil
+	prometheus.SetIngestQueueDepth(len(w.buffer))
+	w.mu.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+
+	start := time.Now()
+	err := database.Session.CreateInBatches(&records, w.flushSize).Error
+	if err != nil {
+		// Retry once, a short database hiccup should not lose data
+		time.Sleep(100 * time.Millisecond)
+		resetIds(records)
+		err = database.Session.CreateInBatches(&records, w.flushSize).Error
+	}
+	written := len(records)
+	if err != nil {
+		// A row the database rejects fails its whole INSERT, so the rows of
+		// the other sites are written apart from it
+		log.Printf("Error flushing %d traffic records, writing them one chunk at a time: %v", len(records), err)
+		resetIds(records)
+		written = w.writeApart(records)
+	}
+	prometheus.ObserveIngestFlush(time.Since(start))
+
+	if dropped := len(records) - written; dropped > 0 {
+		prometheus.AddIngestDropped(dropped)
+	}
+	prometheus.AddIngestFlushed(written)
+}
+
+// writeApart writes the records chunk by chunk, and the rows of a failing
+// chunk one by one. It returns how many records were written.
+func (w *Writer) writeApart(records []structs.WebMetric) int {
+	written := 0
+	var lastErr error
+	for start := 0; start < len(records); start += w.flushSize {
+		chunk := records[start:min(start+w.flushSize, len(records))]
+		if err := database.Session.Create(&chunk).Error; err == nil {
+			written += len(chunk)
+			continue
+		}
+		resetIds(chunk)
+		for i := range chunk {
+			if err := database.Session.Create(&chunk[i]).Error; err != nil {
+				lastErr = err
+				continue
+			}
+			written++
+		}
+	}
+	if lastErr != nil {
+		log.Printf("Dropped %d traffic records, last error: %v", len(records)-written, lastErr)
+	}
+	return written
+}
+
+// resetIds clears the ids a failed, rolled back INSERT assigned, so the
+// records get fresh ones when they are written again.
+func resetIds(records []structs.WebMetric) {
+	for i := range records {
+		records[i].Id = 0
+	}
+}
+
+// sanitize makes a page view fit its columns: the text fields are cut to
+// their length, with invalid UTF-8 and NUL bytes removed, which Postgres
+// rejects.
+func sanitize(record *structs.WebMetric) {
+	record.Page = clean(record.Page, 255)
+	record.Site = clean(record.Site, 255)
+	record.Ip = clean(record.Ip, 255)
+	record.SessionId = clean(record.SessionId, 255)
+	record.Browser = clean(record.Browser, 64)
+	record.BrowserVersion = clean(record.BrowserVersion, 32)
+	record.Os = clean(record.Os, 64)
+	record.OsVersion = clean(record.OsVersion, 32)
+	record.Device = clean(record.Device, 16)
+	record.Source = clean(record.Source, 16)
+	for _, field := range []**string{&record.CountryName, &record.City, &record.Region, &record.ReferrerSource,
+		&record.UtmSource, &record.UtmMedium, &record.UtmCampaign, &record.UtmTerm, &record.UtmContent} {
+		cleanPointer(field, 255)
+	}
+	cleanPointer(&record.CountryCode, 2)
+	cleanPointer(&record.Referrer, 2048)
+}
+
+// SanitizeEvent makes a custom event fit its columns like sanitize does for
+// page views. Keys and string values of the properties are cleaned as well,
+// JSONB rejects NUL characters.
+func SanitizeEvent(record *structs.Event) {
+	record.Site = clean(record.Site, 255)
+	record.Page = clean(record.Page, 255)
+	record.SessionId = clean(record.SessionId, 255)
+	record.Name = clean(record.Name, 255)
+	if record.Properties != nil {
+		record.Properties = cleanValue(map[string]interface{}(record.Properties)).(map[string]interface{})
+	}
+}
+
+// cleanValue cleans the strings of a decoded JSON value.
+func cleanValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.ToValidUTF8(strings.ReplaceAll(v, "\x00", ""), "")
+	case []interface{}:
+		for i := range v {
+			v[i] = cleanValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		cleaned := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			cleaned[cleanValue(key).(string)] = cleanValue(item)
+		}
+		return cleaned
+	}
+	return value
+}
+
+// cleanPointer cleans an optional field. A changed value gets a new pointer,
+// the old one can be shared, e.g. by the geolocation of a batch.
+func cleanPointer(field **string, length int) {
+	if *field == nil {
+		return
+	}
+	if cleaned := clean(**field, length); cleaned != **field {
+		*field = &cleaned
+	}
+}
+
+// clean returns value as valid UTF-8 without NUL bytes, cut to length characters.
+func clean(value string, length int) string {
+	value = strings.ToValidUTF8(strings.ReplaceAll(value, "\x00", ""), "")
+	if utf8.RuneCountInString(value) > length {
+		value = string([]rune(value)[:length])
+	}
+	return value
+}
@@ -14,7 +14,7 @@ func activeUsersSnapShot() {
 	pages := []string{"irodalomerettsegi.hu"}
 
 	for _, page := range pages {
-		count := statistics.ActiveUsers(page)
+		count := statistics.ActiveUsers(statistics.Scope{Site: page})
 		record := structs.ActiveUsers{
 			Page:          page,
 			NumberOfUsers: int(count),
@@ -0,0 +1,176 @@
+// Package live keeps the recent activity of every site in memory, fed by the
+// ingest path, and notifies the subscribers of the live stream. The state is
+// per process, every backend instance only sees the hits it ingested.
+package live
+
+import (
+	"statistics/structs"
+	"sync"
+	"time"
+)
+
+const (
+	activeWindow = 5 * time.Minute // Same window as statistics.ActiveUsers
+	rateWindow   = 60              // Seconds page views per second are averaged over
+	latestSize   = 10              // Entries of the latest pages and countries
+)
+
+// site is the recent activity of one site.
+type site struct {
+	sessions  map[string]time.Time // Last page view of each active session
+	seconds   [rateWindow]int64    // Unix second of each slot of counts
+	counts    [rateWindow]int
+	pages     []structs.LivePage
+	countries []structs.LiveCountry
+	pruned    time.Time
+
+	subscribers map[chan struct{}]bool
+}
+
+var (
+	mu    sync.Mutex
+	sites = map[string]*site{}
+)
+
+func siteFor(name string) *site {
+	s, ok := sites[name]
+	if !ok {
+		s = &site{sessions: map[string]time.Time{}, subscribers: map[chan struct{}]bool{}}
+		sites[name] = s
+	}
+	return s
+}
+
+// Publish records accepted page views. Bot traffic and hits older than the
+// active window, e.g. from offline batches, are skipped.
+func Publish(records ...structs.WebMetric) {
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	touched := map[*site]bool{}
+	for _, record := range records {
+		if record.IsBot || now.Sub(record.Timestamp) > activeWindow {
+			continue
+		}
+		s := siteFor(record.Site)
+		touched[s] = true
+
+		if record.Timestamp.After(s.sessions[record.SessionId]) {
+			s.sessions[record.SessionId] = record.Timestamp
+		}
+
+		second := record.Timestamp.Unix()
+		slot := second % rateWindow
+		if s.seconds[slot] != second {
+			s.seconds[slot], s.counts[slot] = second, 0
+		}
+		s.counts[slot]++
+
+		page := structs.LivePage{Page: record.Page, Timestamp: record.Timestamp}
+		if record.CountryCode != nil {
+			page.CountryCode = *record.CountryCode
+		}
+		s.pages = prepend(s.pages, page, latestSize)
+
+		if record.CountryCode != nil && *record.CountryCode != "" {
+			country := structs.LiveCountry{CountryCode: *record.CountryCode, Timestamp: record.Timestamp}
+			if record.CountryName != nil {
+				country.CountryName = *record.CountryName
+			}
+			// A country is listed once, at its latest page view
+			for i, existing := range s.countries {
+				if existing.CountryCode == country.CountryCode {
+					s.countries = append(s.countries[:i], s.countries[i+1:]...)
+					break
+				}
+			}
+			s.countries = prepend(s.countries, country, latestSize)
+		}
+	}
+
+	for s := range touched {
+		s.prune(now)
+		for subscriber := range s.subscribers {
+			select {
+			case subscriber <- struct{}{}:
+			default: // A notification is already pending
+			}
+		}
+	}
+}
+
+func prepend[T any](list []T, item T, max int) []T {
+	list = append([]T{item}, list...)
+	if len(list) > max {
+		list = list[:max]
+	}
+	return list
+}
+
+// prune forgets the sessions that left the active window, at most every few seconds.
+func (s *site) prune(now time.Time) {
+	if now.Sub(s.pruned) < 10*time.Second {
+		return
+	}
+	s.pruned = now
+	for session, seen := range s.sessions {
+		if now.Sub(seen) > activeWindow {
+			delete(s.sessions, session)
+		}
+	}
+}
+
+// Snapshot returns the current state of a site.
+func Snapshot(name string) structs.LiveSnapshot {
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshot := structs.LiveSnapshot{Site: name, LatestPages: []structs.LivePage{}, LatestCountries: []structs.LiveCountry{}}
+	s, ok := sites[name]
+	if !ok {
+		return snapshot
+	}
+
+	for _, seen := range s.sessions {
+		if now.Sub(seen) <= activeWindow {
+			snapshot.ActiveUsers++
+		}
+	}
+
+	total, current := 0, now.Unix()
+	for slot := range s.seconds {
+		if current-s.seconds[slot] < rateWindow {
+			total += s.counts[slot]
+		}
+	}
+	snapshot.PageViewsPerSecond = float64(total) / rateWindow
+
+	snapshot.LatestPages = append(snapshot.LatestPages, s.pages...)
+	snapshot.LatestCountries = append(snapshot.LatestCountries, s.countries...)
+	return snapshot
+}
+
+// Subscribe returns a channel that receives a signal after page views of the
+// site were published. Signals are coalesced, the receiver reads Snapshot.
+func Subscribe(name string) chan struct{} {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscriber := make(chan struct{}, 1)
+	siteFor(name).subscribers[subscriber] = true
+	return subscriber
+}
+
+// Unsubscribe stops the signals of a channel returned by Subscribe.
+func Unsubscribe(name string, subscriber chan struct{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if s, ok := sites[name]; ok {
+		delete(s.subscribers, subscriber)
+	}
+}
@@ -1,14 +1,148 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"statistics/auth"
+	"statistics/botdetect"
 	"statistics/database"
 	"statistics/geolocation"
+	"statistics/ingest"
+	"statistics/migrations"
+	"statistics/privacy"
 	"statistics/server"
+	"statistics/sessions"
+	"statistics/sites"
+	"strconv"
+	"text/tabwriter"
+	"time"
 )
 
+const usage = `Usage: main [command]
+
+Commands:
+  serve              Run the server (default)
+  migrate up [n]     Apply the pending migrations, or only the next n
+  migrate down [n]   Revert the last n applied migrations (default 1)
+  migrate status     List the migrations and when they were applied
+  sites unregistered List the sites with page views that are not registered
+  sites register <site>...
+                     Register sites with page views from before the registry
+`
+
 func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	switch {
+	case args[0] == "serve" && len(args) == 1:
+		serve()
+	case args[0] == "migrate" && len(args) > 1:
+		migrate(args[1], args[2:])
+	case args[0] == "sites" && len(args) == 2 && args[1] == "unregistered":
+		listUnregisteredSites()
+	case args[0] == "sites" && len(args) > 2 && args[1] == "register":
+		registerSites(args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// migrate runs a migrate subcommand.
+func migrate(command string, args []string) {
+	count := 0
+	if len(args) > 1 || (len(args) == 1 && command == "status") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if len(args) == 1 {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid number of migrations: %q", args[0])
+		}
+		count = parsed
+	}
+
+	if err := database.DatabaseInitSession(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+
+	var err error
+	switch command {
+	case "up":
+		err = migrations.Up(count)
+	case "down":
+		if count == 0 {
+			count = 1
+		}
+		err = migrations.Down(count)
+	case "status":
+		err = printStatus()
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printStatus() error {
+	statuses, err := migrations.Statuses()
+	if err != nil {
+		return err
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	return out.Flush()
+}
+
+// listUnregisteredSites prints the sites with page views that are not registered.
+func listUnregisteredSites() {
+	if err := database.DatabaseInitSession(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	unregistered, err := sites.Unregistered()
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "SITE\tPAGE VIEWS")
+	for _, site := range unregistered {
+		fmt.Fprintf(out, "%s\t%d\n", site.Name, site.PageViews)
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// registerSites registers sites by name and prints their ingest keys.
+func registerSites(names []string) {
+	if err := database.DatabaseInitSession(); err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	for _, name := range names {
+		site, err := sites.Register(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Registered %s, ingest key: %s\n", site.Name, site.IngestKey)
+	}
+}
+
+// serve runs the server until it is stopped. The schema has to be migrated.
+func serve() {
 	// Database initialization
 	error := database.DatabaseInitSession()
 	if error != nil {
@@ -17,6 +151,21 @@ func main() {
 		log.Println("Connected to TimescaleDB successfully")
 	}
 
+	if err := migrations.Check(); err != nil {
+		panic("Failed to check the database schema: " + err.Error())
+	}
+	if err := database.Setup(); err != nil {
+		panic("Failed to set up the database: " + err.Error())
+	}
+
+	if err := sites.EnsureIngestKeys(); err != nil {
+		log.Printf("WARNING: Failed to generate ingest keys: %v", err)
+	}
+
+	if err := auth.Init(); err != nil {
+		panic("Failed to initialize authentication: " + err.Error())
+	}
+
 	// GeoIP initialization
 	geoDBPath := os.Getenv("GEODB_PATH")
 	if geoDBPath == "" {
@@ -29,5 +178,26 @@ func main() {
 	}
 	defer geolocation.Close()
 
+	// Bot detection datacenter ranges
+	rangesPath := os.Getenv("BOT_IP_RANGES_PATH")
+	if rangesPath == "" {
+		rangesPath = "/geodb/datacenter-ranges.txt" // Default path
+	}
+
+	if err := botdetect.LoadDatacenterRanges(rangesPath); err != nil {
+		log.Printf("WARNING: Failed to load datacenter IP ranges: %v", err)
+		log.Println("Continuing with user agent and hit rate bot detection only")
+	}
+
+	privacy.Init()
+
+	// Buffered writer for page views, drained after the server stops
+	ingest.Start()
+	defer ingest.Close()
+
+	// Materialized sessions for the reports, stopped before the writer drains
+	sessions.Start()
+	defer sessions.Close()
+
 	server.Server()
 }
@@ -0,0 +1,336 @@
+// Package migrations versions the database schema. Migrations are SQL files
+// embedded in the binary, applied in order and recorded in the
+// schema_migrations table:
+//
+//	sql/<version>_<name>.up.sql             applies the migration
+//	sql/<version>_<name>.down.sql           reverts it
+//	sql/<version>_<name>.timescale.up.sql   used instead when TimescaleDB is available
+//	sql/<version>_<name>.timescale.down.sql
+//
+// TimescaleDB falls back to the plain files when a migration has no timescale
+// variant. A migration with only timescale files is TimescaleDB-only and runs
+// nothing on plain Postgres, e.g. the hypertables. A file runs in a
+// transaction unless its first line is "-- migrate:no-transaction", its
+// statements then run one by one.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"statistics/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockId is the advisory lock that keeps two migration runs apart.
+const lockId = 727004
+
+const noTransaction = "-- migrate:no-transaction"
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+?)(\.timescale)?\.(up|down)\.sql$`)
+
+// Migration is a schema change, the SQL of both databases in both directions.
+type Migration struct {
+	Version int
+	Name    string
+
+	up, down                   string
+	timescaleUp, timescaleDown string
+}
+
+// script returns the SQL of the migration for the database, the plain file
+// when a TimescaleDB database has no timescale variant of it.
+func (m Migration) script(timescale, up bool) string {
+	plain, variant := m.up, m.timescaleUp
+	if !up {
+		plain, variant = m.down, m.timescaleDown
+	}
+	if timescale && variant != "" {
+		return variant
+	}
+	return plain
+}
+
+// Status is a migration and when it was applied, nil when it is pending.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrations are the embedded migrations ordered by version.
+var migrations = mustLoad()
+
+func mustLoad() []Migration {
+	loaded, err := load(files)
+	if err != nil {
+		panic("invalid migrations: " + err.Error())
+	}
+	return loaded
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, "sql/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, migration.Name, match[2])
+		}
+
+		switch match[3] + "." + match[4] {
+		case ".up":
+			migration.up = string(content)
+		case ".down":
+			migration.down = string(content)
+		case ".timescale.up":
+			migration.timescaleUp = string(content)
+		case ".timescale.down":
+			migration.timescaleDown = string(content)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if (migration.up == "") != (migration.down == "") || (migration.timescaleUp == "") != (migration.timescaleDown == "") {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		loaded = append(loaded, *migration)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+// Up applies the pending migrations in order, at most limit of them unless
+// limit is 0.
+func Up(limit int) error {
+	return locked(func(conn *gorm.DB, applied map[int]time.Time, timescale bool) error {
+		count := 0
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if limit > 0 && count == limit {
+				break
+			}
+
+			script := migration.script(timescale, true)
+			record := func(tx *gorm.DB) error {
+				return tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name).Error
+			}
+			if err := run(conn, script, record); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+			count++
+		}
+		if count == 0 {
+			log.Println("No pending migrations")
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func Down(steps int) error {
+	return locked(func(conn *gorm.DB, applied map[int]time.Time, timescale bool) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			script := migration.script(timescale, false)
+			record := func(tx *gorm.DB) error {
+				return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+			}
+			if err := run(conn, script, record); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// Statuses lists the embedded migrations and when they were applied.
+func Statuses() ([]Status, error) {
+	applied, err := appliedVersions(database.Session)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// ErrPending is returned by Check when the schema is behind the binary.
+var ErrPending = errors.New("the database schema has pending migrations, run `migrate up` first")
+
+// Check returns ErrPending unless every embedded migration is applied.
+// Migrations applied by a newer binary are only logged.
+func Check() error {
+	applied, err := appliedVersions(database.Session)
+	if err != nil {
+		return err
+	}
+	known := map[int]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		if _, ok := applied[migration.Version]; !ok {
+			return ErrPending
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			log.Printf("WARNING: Migration %d is applied but unknown to this build", version)
+		}
+	}
+	return nil
+}
+
+// locked runs fn on a single connection holding the migration lock, with the
+// applied versions and whether TimescaleDB is available.
+func locked(fn func(conn *gorm.DB, applied map[int]time.Time, timescale bool) error) error {
+	return database.Session.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockId).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockId)
+
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		var timescale bool
+		if err := conn.Raw("SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").Scan(&timescale).Error; err != nil {
+			return fmt.Errorf("failed to look up TimescaleDB: %w", err)
+		}
+		return fn(conn, applied, timescale)
+	})
+}
+
+// appliedVersions creates schema_migrations when missing and returns when
+// each version was applied.
+func appliedVersions(db *gorm.DB) (map[int]time.Time, error) {
+	err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var rows []struct {
+		Version   int
+		AppliedAt time.Time
+	}
+	if err := db.Raw("SELECT version, applied_at FROM schema_migrations").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// run executes script and then record, together in a transaction unless the
+// script opts out.
+func run(conn *gorm.DB, script string, record func(tx *gorm.DB) error) error {
+	if !strings.HasPrefix(script, noTransaction) {
+		return conn.Transaction(func(tx *gorm.DB) error {
+			if strings.TrimSpace(script) != "" {
+				if err := tx.Exec(script).Error; err != nil {
+					return err
+				}
+			}
+			return record(tx)
+		})
+	}
+
+	for _, statement := range splitStatements(script) {
+		if err := conn.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return record(conn)
+}
+
+// splitStatements splits a script at the semicolons outside of quotes,
+// dollar quotes and comments. Statements consisting of comments only are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	start, code := 0, false
+	for i := 0; i < len(script); i++ {
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+			continue
+		case script[i] == '\'':
+			if end := strings.IndexByte(script[i+1:], '\''); end >= 0 {
+				i += end + 1
+			}
+		case script[i] == '$':
+			if tag := dollarTag.FindString(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				}
+			}
+		case script[i] == ';':
+			if code {
+				statements = append(statements, strings.TrimSpace(script[start:i+1]))
+			}
+			start, code = i+1, false
+			continue
+		}
+		if script[i] != ' ' && script[i] != '\t' && script[i] != '\n' && script[i] != '\r' {
+			code = true
+		}
+	}
+	if code {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements
+}
+
+var dollarTag = regexp.MustCompile(`^\$\w*\$`)
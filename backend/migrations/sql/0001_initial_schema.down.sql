@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS session_cursors;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS goals;
+DROP TABLE IF EXISTS site_members;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS sites;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS web_metrics;
@@ -0,0 +1,159 @@
+-- The schema the models had when migrations were introduced. Databases set up
+-- before keep their tables, every statement is skipped when already done.
+CREATE TABLE IF NOT EXISTS web_metrics (
+	id bigserial PRIMARY KEY,
+	timestamp timestamptz NOT NULL,
+	page varchar(255),
+	site varchar(255),
+	ip varchar(255),
+	session_id varchar(255),
+	country_code varchar(2),
+	country_name varchar(255),
+	city varchar(255),
+	region varchar(255),
+	latitude decimal(10,8),
+	longitude decimal(11,8),
+	referrer varchar(2048),
+	referrer_source varchar(255),
+	utm_source varchar(255),
+	utm_medium varchar(255),
+	utm_campaign varchar(255),
+	utm_term varchar(255),
+	utm_content varchar(255),
+	browser varchar(64),
+	browser_version varchar(32),
+	os varchar(64),
+	os_version varchar(32),
+	device varchar(16),
+	source varchar(16),
+	is_bot boolean NOT NULL DEFAULT false
+);
+-- Databases of the first releases have web_metrics with the page view and
+-- geolocation columns only
+ALTER TABLE web_metrics
+	ALTER COLUMN timestamp SET NOT NULL,
+	ADD COLUMN IF NOT EXISTS referrer varchar(2048),
+	ADD COLUMN IF NOT EXISTS referrer_source varchar(255),
+	ADD COLUMN IF NOT EXISTS utm_source varchar(255),
+	ADD COLUMN IF NOT EXISTS utm_medium varchar(255),
+	ADD COLUMN IF NOT EXISTS utm_campaign varchar(255),
+	ADD COLUMN IF NOT EXISTS utm_term varchar(255),
+	ADD COLUMN IF NOT EXISTS utm_content varchar(255),
+	ADD COLUMN IF NOT EXISTS browser varchar(64),
+	ADD COLUMN IF NOT EXISTS browser_version varchar(32),
+	ADD COLUMN IF NOT EXISTS os varchar(64),
+	ADD COLUMN IF NOT EXISTS os_version varchar(32),
+	ADD COLUMN IF NOT EXISTS device varchar(16),
+	ADD COLUMN IF NOT EXISTS source varchar(16),
+	ADD COLUMN IF NOT EXISTS is_bot boolean NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS idx_web_metrics_site_timestamp ON web_metrics (site, timestamp);
+CREATE INDEX IF NOT EXISTS idx_web_metrics_session_timestamp ON web_metrics (session_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS events (
+	id bigserial PRIMARY KEY,
+	timestamp timestamptz,
+	site varchar(255),
+	page varchar(255),
+	session_id varchar(255),
+	name varchar(255),
+	properties jsonb DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events (timestamp);
+CREATE INDEX IF NOT EXISTS idx_events_site ON events (site);
+CREATE INDEX IF NOT EXISTS idx_events_session_id ON events (session_id);
+CREATE INDEX IF NOT EXISTS idx_events_name ON events (name);
+
+CREATE TABLE IF NOT EXISTS sites (
+	id bigserial PRIMARY KEY,
+	name varchar(255),
+	ingest_key varchar(64),
+	allowed_origins text,
+	enabled boolean NOT NULL DEFAULT true,
+	bot_policy varchar(16),
+	organization_id bigint,
+	display_name varchar(255),
+	timezone varchar(64) NOT NULL DEFAULT 'UTC',
+	currency varchar(3) NOT NULL DEFAULT 'EUR',
+	excluded_ips text,
+	excluded_paths text,
+	session_timeout bigint NOT NULL DEFAULT 30,
+	archived_at timestamptz,
+	created_at timestamptz,
+	updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sites_name ON sites (name);
+CREATE INDEX IF NOT EXISTS idx_sites_ingest_key ON sites (ingest_key);
+CREATE INDEX IF NOT EXISTS idx_sites_organization_id ON sites (organization_id);
+
+CREATE TABLE IF NOT EXISTS users (
+	id bigserial PRIMARY KEY,
+	username varchar(255),
+	password_hash varchar(255),
+	superuser boolean NOT NULL DEFAULT false,
+	created_at timestamptz,
+	updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+
+CREATE TABLE IF NOT EXISTS organizations (
+	id bigserial PRIMARY KEY,
+	name varchar(255),
+	created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_name ON organizations (name);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+	id bigserial PRIMARY KEY,
+	organization_id bigint,
+	user_id bigint,
+	role varchar(16)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_member ON organization_members (organization_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS site_members (
+	id bigserial PRIMARY KEY,
+	site_id bigint,
+	user_id bigint,
+	role varchar(16)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_site_member ON site_members (site_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_site_members_user_id ON site_members (user_id);
+
+CREATE TABLE IF NOT EXISTS goals (
+	id bigserial PRIMARY KEY,
+	site_id bigint,
+	name varchar(255),
+	kind varchar(16),
+	pattern varchar(255),
+	duration bigint,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_goals_site_id ON goals (site_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id bigserial PRIMARY KEY,
+	visitor_id varchar(255),
+	site varchar(255),
+	started_at timestamptz NOT NULL,
+	ended_at timestamptz,
+	duration decimal,
+	active_time decimal,
+	page_count bigint,
+	unique_pages bigint,
+	entry_page varchar(255),
+	exit_page varchar(255),
+	country_code varchar(2),
+	country_name varchar(255),
+	referrer_source varchar(255),
+	bounce boolean
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_visitor_id ON sessions (visitor_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_site_started ON sessions (site, started_at);
+
+CREATE TABLE IF NOT EXISTS session_cursors (
+	id bigserial PRIMARY KEY,
+	last_hit_id bigint,
+	caught_up boolean,
+	updated_at timestamptz
+);
@@ -0,0 +1,7 @@
+-- Hypertables cannot be turned back into plain tables in place, web_metrics
+-- and sessions stay hypertables, which work as tables for the previous
+-- schema. Compression is turned off after decompressing every chunk.
+SELECT remove_compression_policy('web_metrics', if_exists => TRUE);
+SELECT remove_retention_policy('web_metrics', if_exists => TRUE);
+SELECT decompress_chunk(chunk, if_compressed => TRUE) FROM show_chunks('web_metrics') AS chunk;
+ALTER TABLE web_metrics SET (timescaledb.compress = false);
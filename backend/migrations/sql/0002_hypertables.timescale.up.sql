@@ -0,0 +1,28 @@
+-- web_metrics and sessions become hypertables partitioned by time, existing
+-- rows are moved into chunks. Unique indexes of a hypertable have to contain
+-- the partitioning column, so the primary keys are extended first.
+CREATE EXTENSION IF NOT EXISTS timescaledb;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'web_metrics') THEN
+		ALTER TABLE web_metrics DROP CONSTRAINT web_metrics_pkey, ADD PRIMARY KEY (id, timestamp);
+		PERFORM create_hypertable('web_metrics', 'timestamp', migrate_data => TRUE);
+	END IF;
+
+	IF NOT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'sessions') THEN
+		ALTER TABLE sessions DROP CONSTRAINT sessions_pkey, ADD PRIMARY KEY (id, started_at);
+		PERFORM create_hypertable('sessions', 'started_at', migrate_data => TRUE);
+	END IF;
+
+	-- Reports filter by site and read time ranges. The policy compressing
+	-- old chunks follows DB_COMPRESS_AFTER, see database.Setup.
+	IF NOT (SELECT compression_enabled FROM timescaledb_information.hypertables WHERE hypertable_name = 'web_metrics') THEN
+		ALTER TABLE web_metrics SET (
+			timescaledb.compress,
+			timescaledb.compress_segmentby = 'site',
+			timescaledb.compress_orderby = 'timestamp DESC, id DESC'
+		);
+	END IF;
+END
+$$;
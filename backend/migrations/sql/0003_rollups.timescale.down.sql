@@ -0,0 +1,2 @@
+DROP MATERIALIZED VIEW IF EXISTS traffic_daily;
+DROP MATERIALIZED VIEW IF EXISTS traffic_hourly;
@@ -0,0 +1,45 @@
+-- migrate:no-transaction
+-- Continuous aggregates cannot be created inside a transaction. They refresh
+-- themselves: the first run of the policy materializes the whole history,
+-- later runs the buckets whose sessions changed, newer buckets are aggregated
+-- at query time.
+
+-- Tables are left over when TimescaleDB was installed after the rollups were created
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM pg_tables WHERE schemaname = current_schema() AND tablename = 'traffic_hourly') THEN
+		DROP TABLE traffic_hourly;
+	END IF;
+	IF EXISTS (SELECT 1 FROM pg_tables WHERE schemaname = current_schema() AND tablename = 'traffic_daily') THEN
+		DROP TABLE traffic_daily;
+	END IF;
+END
+$$;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS traffic_hourly
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 hour', started_at) AS bucket, site, entry_page, country_code,
+	COUNT(*) AS sessions, SUM(page_count) AS page_views, COUNT(*) FILTER (WHERE bounce) AS bounces
+FROM sessions
+GROUP BY time_bucket(INTERVAL '1 hour', started_at), site, entry_page, country_code
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('traffic_hourly',
+	start_offset => NULL,
+	end_offset => INTERVAL '1 hour',
+	schedule_interval => INTERVAL '15 minutes',
+	if_not_exists => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS traffic_daily
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT time_bucket(INTERVAL '1 day', started_at) AS bucket, site, entry_page, country_code,
+	COUNT(*) AS sessions, SUM(page_count) AS page_views, COUNT(*) FILTER (WHERE bounce) AS bounces
+FROM sessions
+GROUP BY time_bucket(INTERVAL '1 day', started_at), site, entry_page, country_code
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('traffic_daily',
+	start_offset => NULL,
+	end_offset => INTERVAL '1 day',
+	schedule_interval => INTERVAL '15 minutes',
+	if_not_exists => TRUE);
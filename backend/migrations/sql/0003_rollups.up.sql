@@ -0,0 +1,37 @@
+-- Without TimescaleDB the rollups are tables the sessions job maintains, see
+-- sessions.refreshRollups. They are filled from the sessions table here.
+CREATE TABLE IF NOT EXISTS traffic_hourly (
+	bucket timestamptz NOT NULL,
+	site varchar(255),
+	entry_page varchar(255),
+	country_code varchar(2),
+	sessions bigint NOT NULL,
+	page_views bigint NOT NULL,
+	bounces bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_traffic_hourly_site_bucket ON traffic_hourly (site, bucket);
+
+INSERT INTO traffic_hourly
+SELECT date_trunc('hour', started_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', site, entry_page, country_code,
+	COUNT(*), SUM(page_count), COUNT(*) FILTER (WHERE bounce)
+FROM sessions
+WHERE NOT EXISTS (SELECT 1 FROM traffic_hourly)
+GROUP BY 1, site, entry_page, country_code;
+
+CREATE TABLE IF NOT EXISTS traffic_daily (
+	bucket timestamptz NOT NULL,
+	site varchar(255),
+	entry_page varchar(255),
+	country_code varchar(2),
+	sessions bigint NOT NULL,
+	page_views bigint NOT NULL,
+	bounces bigint NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_traffic_daily_site_bucket ON traffic_daily (site, bucket);
+
+INSERT INTO traffic_daily
+SELECT date_trunc('day', started_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', site, entry_page, country_code,
+	COUNT(*), SUM(page_count), COUNT(*) FILTER (WHERE bounce)
+FROM sessions
+WHERE NOT EXISTS (SELECT 1 FROM traffic_daily)
+GROUP BY 1, site, entry_page, country_code;
@@ -0,0 +1,4 @@
+ALTER TABLE session_cursors
+	DROP COLUMN IF EXISTS rescan_hit_id,
+	DROP COLUMN IF EXISTS checkpoint_hit_id,
+	DROP COLUMN IF EXISTS checkpoint_at;
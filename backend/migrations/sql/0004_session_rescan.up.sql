@@ -0,0 +1,10 @@
+-- The sessions job rescans the page views of the last SESSIONS_OVERLAP, see
+-- sessions.step. Existing cursors start the rescan at their position.
+ALTER TABLE session_cursors
+	ADD COLUMN IF NOT EXISTS rescan_hit_id bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS checkpoint_hit_id bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS checkpoint_at timestamptz NOT NULL DEFAULT now();
+
+UPDATE session_cursors
+SET rescan_hit_id = COALESCE(last_hit_id, 0), checkpoint_hit_id = COALESCE(last_hit_id, 0)
+WHERE rescan_hit_id = 0;
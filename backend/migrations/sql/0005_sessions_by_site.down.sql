@@ -0,0 +1,2 @@
+-- Nothing to undo, the sessions rebuilt by site stay valid sessions.
+SELECT 1;
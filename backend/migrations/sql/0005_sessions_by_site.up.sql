@@ -0,0 +1,19 @@
+-- Sessions are split by site since this version, a visitor ID used on several
+-- sites had its page views merged into sessions of one of them. The cursor of
+-- the sessions job is moved back before the first page view of such a
+-- visitor, so the job rebuilds their sessions on each site.
+UPDATE session_cursors
+SET last_hit_id = LEAST(COALESCE(last_hit_id, 0), shared.first_hit_id - 1),
+	rescan_hit_id = LEAST(rescan_hit_id, shared.first_hit_id - 1),
+	checkpoint_hit_id = LEAST(checkpoint_hit_id, shared.first_hit_id - 1)
+FROM (
+	SELECT MIN(first_hit_id) AS first_hit_id
+	FROM (
+		SELECT MIN(id) AS first_hit_id
+		FROM web_metrics
+		WHERE is_bot = false
+		GROUP BY session_id
+		HAVING COUNT(DISTINCT site) > 1
+	) AS visitors
+) AS shared
+WHERE shared.first_hit_id IS NOT NULL;
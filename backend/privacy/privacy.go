@@ -0,0 +1,100 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	anonymizeIP bool
+	cookieless  bool
+	saltSecret  []byte
+
+	saltMu     sync.Mutex
+	saltDay    string
+	randomSalt []byte
+)
+
+// Init reads the privacy settings from the environment:
+//
+//	PRIVACY_ANONYMIZE_IP=true  truncate client IPs before they are stored
+//	PRIVACY_COOKIELESS=true    derive visitor IDs on the server instead of using the sessionId UUID
+//	PRIVACY_SALT_SECRET        secret the daily salt is derived from, shared by all instances
+func Init() {
+	anonymizeIP = os.Getenv("PRIVACY_ANONYMIZE_IP") == "true"
+	cookieless = os.Getenv("PRIVACY_COOKIELESS") == "true"
+	saltSecret = []byte(os.Getenv("PRIVACY_SALT_SECRET"))
+
+	if cookieless && len(saltSecret) == 0 {
+		log.Println("WARNING: PRIVACY_SALT_SECRET is not set, visitor IDs use a random salt and change on restart")
+	}
+	log.Printf("Privacy mode: anonymize IP: %t, cookieless: %t", anonymizeIP, cookieless)
+}
+
+// Cookieless reports whether visitor IDs are derived on the server.
+func Cookieless() bool {
+	return cookieless
+}
+
+// AnonymizeIP truncates an address for storage when anonymization is enabled:
+// IPv4 keeps the first three octets (/24), IPv6 the first 48 bits.
+// Unparsable input is dropped entirely.
+func AnonymizeIP(ipStr string) string {
+	if !anonymizeIP {
+		return ipStr
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(ipStr))
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// VisitorID derives a cookieless visitor identifier from the full IP, the user
+// agent and the site, hashed with a salt that rotates every UTC day. The same
+// visitor gets a new, unlinkable ID the next day.
+func VisitorID(ip, userAgent, site string, now time.Time) string {
+	mac := hmac.New(sha256.New, dailySalt(now))
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	mac.Write([]byte{0})
+	mac.Write([]byte(site))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// dailySalt returns the salt of the given UTC day. With PRIVACY_SALT_SECRET it
+// is derived from the secret, so every instance computes the same one; without
+// it a random salt is generated and kept in memory only.
+func dailySalt(now time.Time) []byte {
+	day := now.UTC().Format("2006-01-02")
+
+	if len(saltSecret) > 0 {
+		mac := hmac.New(sha256.New, saltSecret)
+		mac.Write([]byte(day))
+		return mac.Sum(nil)
+	}
+
+	saltMu.Lock()
+	defer saltMu.Unlock()
+	if saltDay != day {
+		randomSalt = make([]byte, 32)
+		if _, err := rand.Read(randomSalt); err != nil {
+			log.Println("Error generating visitor salt:", err)
+		}
+		saltDay = day
+	}
+	return randomSalt
+}
@@ -0,0 +1,92 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		anonymize bool
+		want      string
+	}{
+		{name: "disabled", ip: "192.0.2.123", anonymize: false, want: "192.0.2.123"},
+		{name: "disabled keeps invalid input", ip: "unknown", anonymize: false, want: "unknown"},
+		{name: "IPv4", ip: "192.0.2.123", anonymize: true, want: "192.0.2.0"},
+		{name: "IPv4 network address", ip: "10.1.2.0", anonymize: true, want: "10.1.2.0"},
+		{name: "IPv4 with spaces", ip: " 203.0.113.9 ", anonymize: true, want: "203.0.113.0"},
+		{name: "IPv4-mapped IPv6", ip: "::ffff:192.0.2.123", anonymize: true, want: "192.0.2.0"},
+		{name: "IPv6", ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", anonymize: true, want: "2001:db8:85a3::"},
+		{name: "IPv6 short form", ip: "2001:db8::1", anonymize: true, want: "2001:db8::"},
+		{name: "IPv6 loopback", ip: "::1", anonymize: true, want: "::"},
+		{name: "invalid", ip: "unknown", anonymize: true, want: ""},
+		{name: "empty", ip: "", anonymize: true, want: ""},
+	}
+
+	t.Cleanup(func() { anonymizeIP = false })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anonymizeIP = tt.anonymize
+			if got := AnonymizeIP(tt.ip); got != tt.want {
+				t.Errorf("AnonymizeIP(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisitorID(t *testing.T) {
+	saltSecret = []byte("test secret")
+	t.Cleanup(func() { saltSecret = nil })
+
+	morning := time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, 5, 15, 23, 59, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 5, 16, 0, 1, 0, 0, time.UTC)
+	// Still the 15th in UTC, the salt follows UTC days
+	eastOfUTC := time.Date(2024, 5, 16, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+
+	base := VisitorID("192.0.2.1", "Firefox", "example.com", morning)
+	if len(base) != 32 {
+		t.Fatalf("VisitorID() = %q, want 32 hex characters", base)
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		site      string
+		now       time.Time
+		wantSame  bool
+	}{
+		{name: "same day", ip: "192.0.2.1", userAgent: "Firefox", site: "example.com", now: evening, wantSame: true},
+		{name: "same UTC day in another timezone", ip: "192.0.2.1", userAgent: "Firefox", site: "example.com", now: eastOfUTC, wantSame: true},
+		{name: "next day", ip: "192.0.2.1", userAgent: "Firefox", site: "example.com", now: nextDay},
+		{name: "other address", ip: "192.0.2.2", userAgent: "Firefox", site: "example.com", now: morning},
+		{name: "other user agent", ip: "192.0.2.1", userAgent: "Chrome", site: "example.com", now: morning},
+		{name: "other site", ip: "192.0.2.1", userAgent: "Firefox", site: "example.org", now: morning},
+		{name: "fields do not run together", ip: "192.0.2.1F", userAgent: "irefox", site: "example.com", now: morning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VisitorID(tt.ip, tt.userAgent, tt.site, tt.now)
+			if (got == base) != tt.wantSame {
+				t.Errorf("VisitorID() = %q, base %q, want same %t", got, base, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestRandomSalt(t *testing.T) {
+	saltSecret = nil
+	morning := time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)
+
+	first := VisitorID("192.0.2.1", "Firefox", "example.com", morning)
+	if again := VisitorID("192.0.2.1", "Firefox", "example.com", morning.Add(time.Hour)); again != first {
+		t.Errorf("the random salt changed within a day: %q, %q", first, again)
+	}
+	if next := VisitorID("192.0.2.1", "Firefox", "example.com", morning.AddDate(0, 0, 1)); next == first {
+		t.Error("the random salt did not change on the next day")
+	}
+}
@@ -0,0 +1,67 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ingestQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "statistics_ingest_queue_depth",
+		Help: "Number of page views waiting in the ingest buffer",
+	})
+	ingestFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "statistics_ingest_flush_duration_seconds",
+		Help:    "Time taken to write a buffered batch of page views to the database",
+		Buckets: prometheus.DefBuckets,
+	})
+	ingestFlushedRecords = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "statistics_ingest_flushed_records_total",
+		Help: "Page views written to the database by the ingest writer",
+	})
+	ingestDroppedRecords = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "statistics_ingest_dropped_records_total",
+		Help: "Page views lost because the database write failed",
+	})
+	ingestQueueFull = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "statistics_ingest_queue_full_total",
+		Help: "Requests rejected with 503 because the ingest buffer was full",
+	})
+)
+
+// SetIngestQueueDepth records the current number of buffered page views.
+func SetIngestQueueDepth(depth int) {
+	ingestQueueDepth.Set(float64(depth))
+}
+
+// ObserveIngestFlush records the latency of a flush.
+func ObserveIngestFlush(duration time.Duration) {
+	ingestFlushDuration.Observe(duration.Seconds())
+}
+
+// AddIngestFlushed counts page views written to the database.
+func AddIngestFlushed(records int) {
+	ingestFlushedRecords.Add(float64(records))
+}
+
+// AddIngestDropped counts page views that could not be written.
+func AddIngestDropped(records int) {
+	ingestDroppedRecords.Add(float64(records))
+}
+
+// IncIngestQueueFull counts a request rejected because of backpressure.
+func IncIngestQueueFull() {
+	ingestQueueFull.Inc()
+}
+
+var ingestRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "statistics_ingest_rejected_total",
+	Help: "Hits rejected by the site registry, by reason",
+}, []string{"reason"})
+
+// IncIngestRejected counts a hit rejected for an unknown or disabled site, a bad key or a disallowed origin.
+func IncIngestRejected(reason string) {
+	ingestRejected.With(prometheus.Labels{"reason": reason}).Inc()
+}
@@ -3,8 +3,10 @@ package prometheus
 import (
 	"fmt"
 	"statistics/database"
+	"statistics/goals"
+	"statistics/sites"
 	"statistics/statistics"
-	"statistics/structs"
+	"strconv"
 	"time"
 
 	"github.com/mmcloughlin/geohash"
@@ -25,6 +27,10 @@ var (
 		Name: "statistics_minute_spent",
 		Help: "Average minutes spent on site in last 24h by site",
 	}, []string{"site"})
+	goalConversionsBySite = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "statistics_goal_conversions",
+		Help: "Sessions that reached a goal in last 24 hours by site and goal",
+	}, []string{"site", "goal_id", "goal"})
 
 	// Geolocation metrics
 	trafficByCity = promauto.NewGaugeVec(prometheus.GaugeOpts{
@@ -44,33 +50,100 @@ var (
 func RecordMetrics() {
 	go func() {
 		for {
-			// Fetch distinct sites
-			var sites []string
-			_ = database.Session.Model(&structs.WebMetric{}).Distinct("site").Pluck("site", &sites).Error
+			// Fetch registered sites
+			names, _ := sites.List()
+
+			// Goal conversions are refreshed less often than the other gauges
+			var seenGoals map[goalLabels]bool
+			if time.Since(goalsUpdated) >= goalRefresh {
+				seenGoals = map[goalLabels]bool{}
+			}
 
 			// Update metrics per site
-			for _, site := range sites {
+			for _, site := range names {
 				if site == "" {
 					continue
 				}
+				scope := statistics.Scope{From: time.Now().Add(-24 * time.Hour), To: time.Now(), Site: site}
 				visitorsBySite.With(prometheus.Labels{"site": site}).Set(
-					float64(statistics.GetUsers(time.Now().Add(-24*time.Hour), time.Now(), site)),
+					float64(statistics.GetUsers(scope)),
 				)
 				activeUsersBySite.With(prometheus.Labels{"site": site}).Set(
-					float64(statistics.ActiveUsers(site)),
+					float64(statistics.ActiveUsers(scope)),
 				)
 				minuteSpentBySite.With(prometheus.Labels{"site": site}).Set(
-					float64(statistics.TimeOnSite(site, time.Now().Add(-24*time.Hour), time.Now())),
+					float64(statistics.TimeOnSite(scope)),
 				)
 
+				if seenGoals != nil {
+					updateGoalMetrics(scope, seenGoals)
+				}
+
 				// Update geolocation metrics
 				updateGeoMetrics(site)
 			}
+			if seenGoals != nil {
+				removeStaleGoals(seenGoals)
+				goalsUpdated = time.Now()
+			}
 			time.Sleep(2 * time.Second)
 		}
 	}()
 }
 
+// goalRefresh is how often the goal conversions are recounted, a query per
+// goal and site.
+const goalRefresh = time.Minute
+
+// goalLabels are the labels of an exported goal conversion series.
+type goalLabels struct {
+	site, id, name string
+}
+
+var (
+	// goalSeries are the labels of the exported goal conversions.
+	goalSeries   = map[goalLabels]bool{}
+	goalsUpdated time.Time
+)
+
+// updateGoalMetrics exports the conversions of the goals of the scope's site
+// and records their labels in seen. A goal that could not be counted keeps its
+// previous value.
+func updateGoalMetrics(scope statistics.Scope, seen map[goalLabels]bool) {
+	siteGoals, err := goals.ForSite(scope.Site)
+	if err != nil {
+		for labels := range goalSeries {
+			if labels.site == scope.Site {
+				seen[labels] = true
+			}
+		}
+		return
+	}
+	for _, goal := range siteGoals {
+		labels := goalLabels{site: scope.Site, id: strconv.FormatUint(uint64(goal.Id), 10), name: goal.Name}
+		seen[labels] = true
+		_, conversions, err := statistics.GetGoalTotals(scope, goal)
+		if err != nil {
+			continue
+		}
+		goalConversionsBySite.With(labels.prometheus()).Set(float64(conversions))
+	}
+}
+
+func (l goalLabels) prometheus() prometheus.Labels {
+	return prometheus.Labels{"site": l.site, "goal_id": l.id, "goal": l.name}
+}
+
+// removeStaleGoals drops the series of goals that were deleted or renamed.
+func removeStaleGoals(seen map[goalLabels]bool) {
+	for labels := range goalSeries {
+		if !seen[labels] {
+			goalConversionsBySite.Delete(labels.prometheus())
+		}
+	}
+	goalSeries = seen
+}
+
 // updateGeoMetrics calculates and updates all geography-based metrics for a site
 func updateGeoMetrics(site string) {
 	now := time.Now()
@@ -92,7 +165,7 @@ func updateGeoMetrics(site string) {
 			COALESCE(country_name, 'Unknown') as country_name,
 			COUNT(DISTINCT session_id) as count
 		FROM web_metrics
-		WHERE timestamp >= ? AND timestamp <= ? AND site = ?
+		WHERE timestamp >= ? AND timestamp <= ? AND is_bot = false AND site = ?
 		GROUP BY city, country_code, country_name
 	`
 	_ = database.Session.Raw(query, last24h, now, site).Scan(&cityStats).Error
@@ -119,7 +192,7 @@ func updateGeoMetrics(site string) {
 			COALESCE(country_name, 'Unknown') as country_name,
 			COUNT(DISTINCT session_id) as count
 		FROM web_metrics
-		WHERE timestamp >= ? AND timestamp <= ? AND site = ?
+		WHERE timestamp >= ? AND timestamp <= ? AND is_bot = false AND site = ?
 		GROUP BY country_code, country_name
 	`
 	_ = database.Session.Raw(countryQuery, last5min, now, site).Scan(&countryStats).Error
@@ -149,7 +222,7 @@ func updateGeoMetrics(site string) {
 			COALESCE(country_code, 'XX') as country_code,
 			COUNT(DISTINCT session_id) as count
 		FROM web_metrics
-		WHERE timestamp >= ? AND timestamp <= ? AND site = ?
+		WHERE timestamp >= ? AND timestamp <= ? AND is_bot = false AND site = ?
 		  AND latitude IS NOT NULL AND longitude IS NOT NULL
 		GROUP BY latitude, longitude, city, country_code
 	`
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"statistics/access"
+	"statistics/auth"
+	"statistics/database"
+	"statistics/sites"
+	"statistics/structs"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// getMe returns the current user and the sites it can see.
+func getMe(c *gin.Context) {
+	var user structs.User
+	if err := database.Session.First(&user, auth.UserId(c)).Error; err != nil {
+		log.Println("Error fetching user:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	visible, _, err := access.VisibleSites(user.Id)
+	if err != nil {
+		log.Println("Error fetching visible sites:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user, "sites": visible})
+}
+
+func createUser(c *gin.Context) {
+	var req structs.UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Username) == "" || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		return
+	}
+
+	var count int64
+	database.Session.Model(&structs.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		return
+	}
+
+	user, err := auth.CreateUser(strings.TrimSpace(req.Username), req.Password, req.Superuser)
+	if err != nil {
+		log.Println("Error creating user:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+func createOrganization(c *gin.Context) {
+	var req structs.OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	organization := structs.Organization{Name: strings.TrimSpace(req.Name)}
+	if err := database.Session.Create(&organization).Error; err != nil {
+		log.Println("Error creating organization:", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Organization could not be created"})
+		return
+	}
+	c.JSON(http.StatusCreated, organization)
+}
+
+// organizationForAdmin loads the organization of the :id path parameter and
+// checks that the caller is its admin. It writes the error response itself.
+func organizationForAdmin(c *gin.Context) (*structs.Organization, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization id"})
+		return nil, false
+	}
+
+	var organization structs.Organization
+	if err := database.Session.First(&organization, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown organization"})
+		} else {
+			log.Println("Error fetching organization:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	role, err := access.OrganizationRole(auth.UserId(c), organization.Id)
+	if err != nil {
+		log.Println("Error checking organization access:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if !access.HasRole(role, access.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The admin role is required in this organization"})
+		return nil, false
+	}
+	return &organization, true
+}
+
+// bindMembership reads and validates a membership request body. It writes the error response itself.
+func bindMembership(c *gin.Context) (*structs.MembershipRequest, bool) {
+	var req structs.MembershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
+		return nil, false
+	}
+	if !access.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be viewer, editor or admin"})
+		return nil, false
+	}
+
+	var count int64
+	database.Session.Model(&structs.User{}).Where("id = ?", req.UserId).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown user"})
+		return nil, false
+	}
+	return &req, true
+}
+
+func addOrganizationMember(c *gin.Context) {
+	organization, ok := organizationForAdmin(c)
+	if !ok {
+		return
+	}
+	req, ok := bindMembership(c)
+	if !ok {
+		return
+	}
+
+	member := structs.OrganizationMember{OrganizationId: organization.Id, UserId: req.UserId, Role: req.Role}
+	err := database.Session.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&member).Error
+	if err != nil {
+		log.Println("Error saving organization member:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func removeOrganizationMember(c *gin.Context) {
+	organization, ok := organizationForAdmin(c)
+	if !ok {
+		return
+	}
+
+	err := database.Session.
+		Where("organization_id = ? AND user_id = ?", organization.Id, c.Param("userId")).
+		Delete(&structs.OrganizationMember{}).Error
+	if err != nil {
+		log.Println("Error removing organization member:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// assignSiteToOrganization moves a site into the organization of the :id path parameter.
+func assignSiteToOrganization(c *gin.Context) {
+	organization, ok := organizationForAdmin(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("site")
+	result := database.Session.Model(&structs.Site{}).Where("name = ?", name).Update("organization_id", organization.Id)
+	if result.Error != nil {
+		log.Println("Error assigning site to organization:", result.Error)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown site"})
+		return
+	}
+	sites.Invalidate(name)
+	c.Status(http.StatusNoContent)
+}
+
+func addSiteMember(c *gin.Context) {
+	site := sites.Get(c.Param("site"))
+	if site == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown site"})
+		return
+	}
+	req, ok := bindMembership(c)
+	if !ok {
+		return
+	}
+
+	member := structs.SiteMember{SiteId: site.Id, UserId: req.UserId, Role: req.Role}
+	err := database.Session.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "site_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&member).Error
+	if err != nil {
+		log.Println("Error saving site member:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func removeSiteMember(c *gin.Context) {
+	site := sites.Get(c.Param("site"))
+	if site == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown site"})
+		return
+	}
+
+	err := database.Session.
+		Where("site_id = ? AND user_id = ?", site.Id, c.Param("userId")).
+		Delete(&structs.SiteMember{}).Error
+	if err != nil {
+		log.Println("Error removing site member:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
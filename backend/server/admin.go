@@ -0,0 +1,20 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"statistics/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getStorageStatus reports the hypertable, compression and retention state of web_metrics.
+func getStorageStatus(c *gin.Context) {
+	status, err := database.StorageStatus()
+	if err != nil {
+		log.Println("Error fetching storage status:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
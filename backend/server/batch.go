@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"statistics/acquisition"
+	"statistics/botdetect"
+	"statistics/geolocation"
+	"statistics/ingest"
+	"statistics/privacy"
+	"statistics/sites"
+	"statistics/structs"
+	"statistics/useragent"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxBatchSize      = 500                // Maximum number of page views in a single batch
+	maxBatchBodyBytes = 1 << 20            // 1 MiB
+	maxClientAge      = 7 * 24 * time.Hour // Oldest client timestamp accepted (offline buffering)
+	maxClientSkew     = 5 * time.Minute    // Tolerated clock skew for timestamps in the future
+)
+
+var errBatchTooLarge = errors.New("batch exceeds the maximum number of items")
+
+// decodeBatch reads either a JSON array or newline-delimited JSON objects.
+func decodeBatch(body []byte) ([]structs.BatchPageView, error) {
+	var items []structs.BatchPageView
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxBatchBodyBytes)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var item structs.BatchPageView
+			if err := json.Unmarshal(line, &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(items) > maxBatchSize {
+		return nil, errBatchTooLarge
+	}
+	return items, nil
+}
+
+// validateBatchItem checks a single page view and returns the time it should be stored with.
+func validateBatchItem(item structs.BatchPageView, now time.Time) (time.Time, error) {
+	if strings.TrimSpace(item.SessionId) == "" {
+		return time.Time{}, errors.New("missing sessionId")
+	}
+	if len(item.SessionId) > maxSessionIdLength {
+		return time.Time{}, errors.New("sessionId is too long")
+	}
+	if item.Timestamp == nil {
+		return now, nil
+	}
+	if item.Timestamp.After(now.Add(maxClientSkew)) {
+		return time.Time{}, errors.New("timestamp is in the future")
+	}
+	if item.Timestamp.Before(now.Add(-maxClientAge)) {
+		return time.Time{}, errors.New("timestamp is too old")
+	}
+	return *item.Timestamp, nil
+}
+
+// userTrafficBatch queues several page views, sent as a JSON array or NDJSON, so they are written together.
+func userTrafficBatch(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBodyBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+		return
+	}
+
+	items, err := decodeBatch(body)
+	if err != nil {
+		if errors.Is(err, errBatchTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch format"})
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Empty batch"})
+		return
+	}
+
+	ip := clientIP(c)
+	// Every item in a batch comes from the same client, one lookup is enough
+	geoData, _ := geolocation.Lookup(ip)
+	client := useragent.Parse(c.Request.UserAgent())
+
+	// A sender with the ingest key is a server or an app SDK forwarding page
+	// views: its address and user agent are its own and its buffered page
+	// views arrive at once, so bot detection does not apply
+	keyed := ingestKey(c) != ""
+	if keyed && client.Device == useragent.DeviceBot {
+		client = useragent.Unknown()
+	}
+	// Otherwise the batch counts as a single request of each of its sessions
+	botSessions := make(map[string]bool)
+
+	now := time.Now()
+	response := structs.BatchResponse{Results: make([]structs.BatchItemResult, len(items))}
+	records := make([]structs.WebMetric, 0, len(items))
+
+	// Items usually share a site, check each site once
+	siteErrors := make(map[string]error)
+
+	for i, item := range items {
+		response.Results[i].Index = i
+		siteErr, checked := siteErrors[item.Site]
+		if !checked {
+			siteErr = authorizeSite(c, item.Site)
+			siteErrors[item.Site] = siteErr
+		}
+		if siteErr != nil {
+			response.Results[i].Error = siteErr.Error()
+			response.Rejected++
+			continue
+		}
+		if privacy.Cookieless() {
+			item.SessionId = privacy.VisitorID(ip, c.Request.UserAgent(), item.Site, now)
+		}
+		timestamp, err := validateBatchItem(item, now)
+		if err != nil {
+			response.Results[i].Error = err.Error()
+			response.Rejected++
+			continue
+		}
+		record := newWebMetric(item.SessionId, item.Site, item.Page, ip, timestamp, geoData)
+		record.Source = structs.SourceBatch
+		acquisition.Apply(&record, item.Referrer, nil)
+		setClient(&record, client)
+		isBot, checked := botSessions[record.SessionId]
+		if !keyed && !checked {
+			isBot, _ = botdetect.Check(ip, client, record.SessionId)
+			botSessions[record.SessionId] = isBot
+		}
+		// Excluded and dropped bot hits count as accepted, like on /put-traffic
+		if !sites.Excluded(item.Site, ip, item.Page) && !applyBotPolicy(&record, isBot) {
+			record.Ip = privacy.AnonymizeIP(record.Ip)
+			records = append(records, record)
+		}
+		response.Results[i].Accepted = true
+		response.Accepted++
+	}
+
+	if len(records) > 0 {
+		if err := ingest.Enqueue(records...); err != nil {
+			respondIngestError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
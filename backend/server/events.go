@@ -0,0 +1,126 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"statistics/database"
+	"statistics/ingest"
+	"statistics/privacy"
+	"statistics/sites"
+	"statistics/statistics"
+	"statistics/structs"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEventNameLength is the size of events.name.
+const maxEventNameLength = 255
+
+// putEvent stores a custom event sent as a JSON body.
+func putEvent(c *gin.Context) {
+	var request structs.EventRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event format"})
+		return
+	}
+
+	if err := authorizeSite(c, request.Site); err != nil {
+		respondRejected(c, err)
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing event name"})
+		return
+	}
+	if privacy.Cookieless() {
+		request.SessionId = privacy.VisitorID(clientIP(c), c.Request.UserAgent(), request.Site, time.Now())
+	}
+	if request.SessionId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing sessionId"})
+		return
+	}
+	if len(request.SessionId) > maxSessionIdLength {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "sessionId", "sessionId is too long")
+		return
+	}
+	if utf8.RuneCountInString(request.Name) > maxEventNameLength {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "name", "name is too long")
+		return
+	}
+
+	now := time.Now()
+	timestamp := now
+	if request.Timestamp != nil {
+		if request.Timestamp.After(now.Add(maxClientSkew)) || request.Timestamp.Before(now.Add(-maxClientAge)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Timestamp out of accepted range"})
+			return
+		}
+		timestamp = *request.Timestamp
+	}
+
+	if sites.Excluded(request.Site, clientIP(c), request.Page) {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	record := structs.Event{
+		Timestamp:  timestamp,
+		Site:       request.Site,
+		Page:       request.Page,
+		SessionId:  request.SessionId,
+		Name:       request.Name,
+		Properties: request.Properties,
+	}
+	// Like page views, the page is cut to its column and NUL bytes are removed
+	ingest.SanitizeEvent(&record)
+
+	if err := database.Session.Create(&record).Error; err != nil {
+		log.Println("Error inserting event:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getEventCounts(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	events, err := statistics.GetEventCounts(params.Scope())
+	if err != nil {
+		log.Println("Error getting event counts:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+func getEventPropertyBreakdown(c *gin.Context) {
+	event, ok := statistics.RequiredParam(c, "event")
+	if !ok {
+		return
+	}
+	property, ok := statistics.RequiredParam(c, "property")
+	if !ok {
+		return
+	}
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	breakdown, err := statistics.GetEventPropertyBreakdown(params.Scope(), event, property)
+	if err != nil {
+		log.Println("Error getting event property breakdown:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event": event, "property": property, "values": breakdown})
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"statistics/database"
+	"statistics/goals"
+	"statistics/statistics"
+	"statistics/structs"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func listGoals(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	siteGoals, err := goals.ForSite(site.Name)
+	if err != nil {
+		log.Println("Error fetching goals:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goals": siteGoals})
+}
+
+func createGoal(c *gin.Context) {
+	var req structs.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal format"})
+		return
+	}
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+
+	goal := structs.Goal{SiteId: site.Id}
+	if err := goals.Apply(&goal, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.Session.Create(&goal).Error; err != nil {
+		log.Println("Error creating goal:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, goal)
+}
+
+// loadGoal reads the goal of the :id path parameter, which must belong to the
+// site of the :site path parameter. It writes the error response itself.
+func loadGoal(c *gin.Context) (*structs.Goal, bool) {
+	site, ok := loadSite(c)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal id"})
+		return nil, false
+	}
+
+	var goal structs.Goal
+	if err := database.Session.Where("id = ? AND site_id = ?", id, site.Id).First(&goal).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown goal"})
+		} else {
+			log.Println("Error fetching goal:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &goal, true
+}
+
+func updateGoal(c *gin.Context) {
+	var req structs.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal format"})
+		return
+	}
+	goal, ok := loadGoal(c)
+	if !ok {
+		return
+	}
+
+	if err := goals.Apply(goal, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.Session.Save(goal).Error; err != nil {
+		log.Println("Error saving goal:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, goal)
+}
+
+func deleteGoal(c *gin.Context) {
+	goal, ok := loadGoal(c)
+	if !ok {
+		return
+	}
+	if err := database.Session.Delete(goal).Error; err != nil {
+		log.Println("Error deleting goal:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getGoalConversions reports the conversions of the goals of a site, or of
+// the single goal of the goal parameter.
+func getGoalConversions(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	if params.Site == "" {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeMissingParameter, "site", "site is required")
+		return
+	}
+	limit, ok := statistics.IntParam(c, "limit", 10, 1, 1000)
+	if !ok {
+		return
+	}
+
+	siteGoals, err := goals.ForSite(params.Site)
+	if err != nil {
+		log.Println("Error fetching goals:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if id := c.Query("goal"); id != "" {
+		var selected []structs.Goal
+		for _, goal := range siteGoals {
+			if strconv.FormatUint(uint64(goal.Id), 10) == id {
+				selected = append(selected, goal)
+			}
+		}
+		if len(selected) == 0 {
+			statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "goal", "Unknown goal")
+			return
+		}
+		siteGoals = selected
+	}
+
+	results := make([]structs.GoalConversions, 0, len(siteGoals))
+	for _, goal := range siteGoals {
+		conversions, err := statistics.GetGoalConversions(params.Scope(), goal, limit)
+		if err != nil {
+			log.Println("Error getting goal conversions:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		results = append(results, conversions)
+	}
+	c.JSON(http.StatusOK, gin.H{"goals": results})
+}
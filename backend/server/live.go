@@ -0,0 +1,94 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"statistics/access"
+	"statistics/auth"
+	"statistics/live"
+	"statistics/statistics"
+	"statistics/structs"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	liveMinInterval = time.Second     // Page views arriving faster are coalesced into one event
+	liveRefresh     = 5 * time.Second // Sent without page views too, so active users age out
+)
+
+// streamsDone is closed on shutdown, open streams would otherwise hold it up.
+var (
+	streamsDone      = make(chan struct{})
+	closeStreamsOnce sync.Once
+)
+
+func closeStreams() {
+	closeStreamsOnce.Do(func() { close(streamsDone) })
+}
+
+// getLiveToken issues a stream token for the live stream of a site, so a
+// browser EventSource can open it with ?token=.
+func getLiveToken(c *gin.Context) {
+	site := access.SiteParam(c)
+	if site == "" {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeMissingParameter, "site", "site is required")
+		return
+	}
+	token, err := auth.IssueStreamToken(auth.UserId(c), site)
+	if err != nil {
+		log.Println("Error issuing stream token:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// getLiveStream pushes the live state of a site as Server-Sent Events: a
+// snapshot right away, then after new page views and on every refresh.
+func getLiveStream(c *gin.Context) {
+	site := access.SiteParam(c)
+	if site == "" {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeMissingParameter, "site", "site is required")
+		return
+	}
+
+	subscriber := live.Subscribe(site)
+	defer live.Unsubscribe(site, subscriber)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+
+	refresh := time.NewTicker(liveRefresh)
+	defer refresh.Stop()
+
+	var last time.Time
+	send := func() {
+		c.SSEvent("snapshot", live.Snapshot(site))
+		c.Writer.Flush()
+		last = time.Now()
+	}
+
+	send()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-streamsDone:
+			return
+		case <-subscriber:
+			if wait := liveMinInterval - time.Since(last); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-c.Request.Context().Done():
+					return
+				}
+			}
+			send()
+		case <-refresh.C:
+			send()
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"statistics/privacy"
+	"statistics/sites"
+	"statistics/structs"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const pixelCookie = "ws_sid"
+
+// transparentGIF is a 1x1 transparent GIF image.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// pixelTraffic records a page view from an image request, for email opens, AMP
+// pages and noscript visitors. The session comes from the sessionId parameter,
+// then from a first-party cookie, and a new one is issued in the cookie otherwise.
+// The cookie only comes back when the backend is served on the same site as
+// the page, cross-site requests get the cookieless ID instead. It always
+// answers with the image, so a broken image is never shown.
+func pixelTraffic(c *gin.Context) {
+	site := c.Query("site")
+	if err := authorizeSite(c, site); err != nil {
+		c.Data(rejectionStatus(err), "image/gif", transparentGIF)
+		return
+	}
+
+	page := c.Query("page")
+	if page == "" {
+		// Without an explicit page, fall back to the page that embedded the image
+		if referer, err := url.Parse(c.Request.Referer()); err == nil {
+			page = referer.Path
+		}
+	}
+
+	sessionId := c.Query("sessionId")
+	if sessionId == "" {
+		sessionId, _ = c.Cookie(pixelCookie)
+	}
+	if len(sessionId) > maxSessionIdLength {
+		// Not an ID this endpoint issued, the visitor gets a new one
+		sessionId = ""
+	}
+	switch {
+	case privacy.Cookieless():
+		sessionId = privacy.VisitorID(clientIP(c), c.Request.UserAgent(), site, time.Now())
+	case sessionId == "" && c.GetHeader("Sec-Fetch-Site") == "cross-site":
+		// The browser would not send a Lax cookie back, each page view would
+		// be a new visitor
+		sessionId = privacy.VisitorID(clientIP(c), c.Request.UserAgent(), site, time.Now())
+	default:
+		if sessionId == "" {
+			sessionId = uuid.New().String()
+		}
+		// Refresh the cookie, a session ends after the site's session timeout without page views
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(pixelCookie, sessionId, int(sites.SessionTimeout(site).Seconds()), "/", "", secureRequest(c), true)
+	}
+
+	if err := queuePageView(c, sessionId, site, page, structs.SourcePixel); err != nil {
+		log.Println("Error queueing pixel traffic data:", err)
+	}
+
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	c.Header("Pragma", "no-cache")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
+
+// secureRequest reports whether the visitor reached the backend over HTTPS,
+// also behind a proxy terminating TLS (X-Forwarded-Proto).
+// PIXEL_COOKIE_SECURE=true marks the cookie Secure regardless.
+func secureRequest(c *gin.Context) bool {
+	if c.Request.TLS != nil || os.Getenv("PIXEL_COOKIE_SECURE") == "true" {
+		return true
+	}
+	proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"statistics/prometheus"
+	"statistics/sites"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ingestKey returns the ingest key from the X-Ingest-Key header or the key parameter.
+func ingestKey(c *gin.Context) string {
+	if key := c.GetHeader("X-Ingest-Key"); key != "" {
+		return key
+	}
+	return c.Query("key")
+}
+
+// requestOrigin returns the Origin header, or the referrer when it is missing.
+func requestOrigin(c *gin.Context) string {
+	if origin := c.GetHeader("Origin"); origin != "" && origin != "null" {
+		return origin
+	}
+	return c.Request.Referer()
+}
+
+// authorizeSite checks a hit against the site registry and counts rejections.
+func authorizeSite(c *gin.Context, site string) error {
+	err := sites.Authorize(site, ingestKey(c), requestOrigin(c))
+	if err != nil {
+		prometheus.IncIngestRejected(rejectionReason(err))
+	}
+	return err
+}
+
+// rejectionStatus maps a registry error to the status code of the response:
+// 404 for unknown sites, 401 for a missing or wrong key, 403 otherwise.
+func rejectionStatus(err error) int {
+	switch {
+	case errors.Is(err, sites.ErrUnknownSite):
+		return http.StatusNotFound
+	case errors.Is(err, sites.ErrInvalidKey):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusForbidden
+	}
+}
+
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, sites.ErrUnknownSite):
+		return "unknown_site"
+	case errors.Is(err, sites.ErrSiteDisabled):
+		return "disabled"
+	case errors.Is(err, sites.ErrSiteArchived):
+		return "archived"
+	case errors.Is(err, sites.ErrInvalidKey):
+		return "invalid_key"
+	default:
+		return "origin"
+	}
+}
+
+// respondRejected answers a hit refused by the site registry.
+func respondRejected(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(rejectionStatus(err), gin.H{"error": err.Error()})
+}
@@ -1,16 +1,28 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"statistics/access"
+	"statistics/acquisition"
 	"statistics/analysis"
-	"statistics/database"
+	"statistics/auth"
+	"statistics/botdetect"
 	"statistics/geolocation"
+	"statistics/ingest"
+	"statistics/privacy"
 	"statistics/prometheus"
+	"statistics/sites"
 	"statistics/statistics"
 	"statistics/structs"
+	"statistics/tracker"
+	"statistics/useragent"
+	"strings"
+	"syscall"
 	"time"
 
 	gpmiddleware "github.com/carousell/gin-prometheus-middleware"
@@ -18,122 +30,221 @@ import (
 	"github.com/google/uuid"
 )
 
+// clientIP returns the visitor address, preferring the headers set by the
+// proxies in front of the backend.
+func clientIP(c *gin.Context) string {
+	ip := c.Request.Header.Get("cf-connecting-ip")
+	if ip == "" {
+		// The first entry of the list is the original client
+		ip, _, _ = strings.Cut(c.Request.Header.Get("X-Forwarded-For"), ",")
+		ip = strings.TrimSpace(ip)
+	}
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+	return ip
+}
+
+// maxSessionIdLength is the size of web_metrics.session_id. Longer IDs are
+// rejected, cutting them could merge visitors.
+const maxSessionIdLength = 255
+
+// newWebMetric builds a page view record and fills in the geolocation fields
+// when the lookup succeeded.
+func newWebMetric(sessionId, site, page, ip string, timestamp time.Time, geoData *geolocation.GeoData) structs.WebMetric {
+	record := structs.WebMetric{
+		SessionId: sessionId,
+		Timestamp: timestamp,
+		Page:      page,
+		Site:      site,
+		Ip:        ip,
+	}
+
+	// Populate geo fields if lookup succeeded
+	if geoData != nil {
+		record.CountryCode = &geoData.CountryCode
+		record.CountryName = &geoData.CountryName
+		record.City = &geoData.City
+		record.Region = &geoData.Region
+		record.Latitude = &geoData.Latitude
+		record.Longitude = &geoData.Longitude
+	}
+	// If geoData is nil, fields remain nil (graceful degradation)
+
+	return record
+}
+
+// setClient stores the parsed User-Agent dimensions on a page view.
+func setClient(record *structs.WebMetric, client useragent.Info) {
+	record.Browser = client.Browser
+	record.BrowserVersion = client.BrowserVersion
+	record.Os = client.OS
+	record.OsVersion = client.OSVersion
+	record.Device = client.Device
+}
+
+// markBot flags a page view coming from a bot and reports whether it should be
+// dropped instead, according to the bot policy of its site.
+func markBot(record *structs.WebMetric, client useragent.Info) bool {
+	isBot, _ := botdetect.Check(record.Ip, client, record.SessionId)
+	return applyBotPolicy(record, isBot)
+}
+
+// applyBotPolicy flags a bot page view and reports whether it should be
+// dropped instead, according to the bot policy of its site.
+func applyBotPolicy(record *structs.WebMetric, isBot bool) bool {
+	if !isBot {
+		return false
+	}
+	if sites.BotPolicy(record.Site) == sites.BotPolicyDrop {
+		return true
+	}
+	record.IsBot = true
+	return false
+}
+
+// queuePageView runs a single page view through the ingest pipeline: referrer
+// and campaign capture, user agent parsing, bot detection and IP anonymization.
+// Bot hits dropped by the site's bot policy and hits excluded by the site's
+// settings return nil, so callers answer them like any other hit.
+func queuePageView(c *gin.Context, sessionId, site, page, source string) error {
+	ip := clientIP(c)
+	if sites.Excluded(site, ip, page) {
+		return nil
+	}
+
+	// Perform geolocation lookup
+	geoData, _ := geolocation.Lookup(ip)
+
+	record := newWebMetric(sessionId, site, page, ip, time.Now(), geoData)
+	record.Source = source
+
+	// The tracked page passes document.referrer as "ref", the header is the fallback
+	referrer := c.Query("ref")
+	if referrer == "" {
+		referrer = c.Request.Referer()
+	}
+	acquisition.Apply(&record, referrer, c.Request.URL.Query())
+	client := useragent.Parse(c.Request.UserAgent())
+	setClient(&record, client)
+
+	if markBot(&record, client) {
+		return nil
+	}
+
+	// Geolocation and bot detection are done, only the truncated address is stored
+	record.Ip = privacy.AnonymizeIP(record.Ip)
+
+	return ingest.Enqueue(record)
+}
+
 func userTraffic(c *gin.Context) {
+	if err := authorizeSite(c, c.Query("site")); err != nil {
+		respondRejected(c, err)
+		return
+	}
+
 	sessionId := c.Query("sessionId")
+	if privacy.Cookieless() {
+		// The visitor ID replaces the client-held UUID, so the hit is recorded right away
+		sessionId = privacy.VisitorID(clientIP(c), c.Request.UserAgent(), c.Query("site"), time.Now())
+	}
 	if sessionId == "" {
 		sessionId = uuid.New().String()
 		c.String(http.StatusOK, sessionId)
 		return
+	} else if len(sessionId) > maxSessionIdLength {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "sessionId", "sessionId is too long")
+		return
 	} else {
-		ip := c.Request.Header.Get("cf-connecting-ip")
-		if ip == "" {
-			ip = c.Request.Header.Get("X-Forwarded-For")
-		}
-		if ip == "" {
-			ip = c.ClientIP()
-		}
-
-		// Perform geolocation lookup
-		geoData, _ := geolocation.Lookup(ip)
-
-		record := structs.WebMetric{
-			SessionId: sessionId,
-			Timestamp: time.Now(),
-			Page:      c.Query("page"),
-			Site:      c.Query("site"),
-			Ip:        ip,
-		}
-
-		// Populate geo fields if lookup succeeded
-		if geoData != nil {
-			record.CountryCode = &geoData.CountryCode
-			record.CountryName = &geoData.CountryName
-			record.City = &geoData.City
-			record.Region = &geoData.Region
-			record.Latitude = &geoData.Latitude
-			record.Longitude = &geoData.Longitude
-		}
-		// If geoData is nil, fields remain nil (graceful degradation)
-
-		err := database.Session.Create(&record).Error
-		if err != nil {
-			log.Println("Error inserting traffic data:", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+		if err := queuePageView(c, sessionId, c.Query("site"), c.Query("page"), structs.SourceScript); err != nil {
+			respondIngestError(c, err)
 			return
 		}
 		c.String(http.StatusOK, sessionId)
 	}
 }
 
-func getLocations(c *gin.Context) {
-	from := c.Query("from")
-	to := c.Query("to")
-	page := c.Query("page")
-	var fromTime, toTime time.Time
-	var err error
-	layout := "2006-01-02"
-	if !(from == "" || to == "") {
-		fromTime, err = time.Parse(layout, from)
-		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
-		}
-		toTime, err = time.Parse(layout, to)
-		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
-		}
+// respondIngestError answers with 503 when the ingest buffer is full or stopped.
+func respondIngestError(c *gin.Context, err error) {
+	if errors.Is(err, ingest.ErrQueueFull) {
+		c.Header("Retry-After", "1")
 	} else {
-		fromTime = time.Now().Add(-24 * time.Hour)
-		toTime = time.Now()
+		log.Println("Error queueing traffic data:", err)
+	}
+	c.AbortWithStatus(http.StatusServiceUnavailable)
+}
+
+func getLocations(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
 	}
-	locations := statistics.GetLocations(fromTime, toTime, page)
+	locations := statistics.GetLocations(params.Scope())
 	c.JSON(http.StatusOK, gin.H{"locations": locations})
 }
 
 func traffic(c *gin.Context) {
-	from := c.Query("from")
-	to := c.Query("to")
-	page := c.Query("page")
-	var fromTime, toTime time.Time
-	var err error
-	layout := "2006-01-02"
-	if !(from == "" || to == "") {
-		fromTime, err = time.Parse(layout, from)
-		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
-		}
-		toTime, err = time.Parse(layout, to)
-		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
-		}
-	} else {
-		fromTime = time.Now().Add(-24 * time.Hour)
-		toTime = time.Now()
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
 	}
-	numberOfUsers := statistics.GetUsers(fromTime, toTime, page)
-	c.JSON(http.StatusOK, gin.H{"traffic": numberOfUsers})
+	numberOfUsers := statistics.GetUsers(params.Scope())
+	response := gin.H{"traffic": numberOfUsers}
+	if scope, ok := params.ComparisonScope(); ok {
+		response["comparison"] = statistics.NewComparison(scope,
+			map[string]float64{"traffic": float64(numberOfUsers)},
+			map[string]float64{"traffic": float64(statistics.GetUsers(scope))})
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func getSites(c *gin.Context) {
-	var sites []string
-	err := database.Session.Model(&structs.WebMetric{}).Distinct("site").Pluck("site", &sites).Error
+	names, err := sites.List()
 	if err != nil {
-		log.Println("Error fetching distinct sites:", err)
+		log.Println("Error fetching registered sites:", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"sites": sites})
+	if visible := access.Sites(c); visible != nil {
+		allowed := make(map[string]bool, len(visible))
+		for _, site := range visible {
+			allowed[site] = true
+		}
+		filtered := make([]string, 0, len(names))
+		for _, name := range names {
+			if allowed[name] {
+				filtered = append(filtered, name)
+			}
+		}
+		names = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{"sites": names})
 }
 
+// CORSMiddleware allows cross-origin requests. CORS_ALLOWED_ORIGINS restricts
+// them to a comma-separated list of origins, every origin is allowed when unset.
 func CORSMiddleware() gin.HandlerFunc {
+	allowedOrigins := make(map[string]struct{})
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins[origin] = struct{}{}
+		}
+	}
+
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		if len(allowedOrigins) == 0 {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			origin := c.GetHeader("Origin")
+			if _, ok := allowedOrigins[origin]; ok {
+				c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+				c.Writer.Header().Set("Vary", "Origin")
+			}
+		}
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, visitorkey")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Ingest-Key, visitorkey")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -145,32 +256,12 @@ func CORSMiddleware() gin.HandlerFunc {
 }
 
 func GetTimeOnTheSite(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	page := c.Query("page")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour)
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
 	}
 
-	result := statistics.TimeOnSite(page, start, end)
+	result := statistics.TimeOnSite(params.Scope())
 
 	response := structs.AvgTimeResponse{AvgTimeSpent: result}
 
@@ -178,102 +269,41 @@ func GetTimeOnTheSite(c *gin.Context) {
 }
 
 func getCohortData(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	weeksStr := c.DefaultQuery("weeks", "12") // Default to 12 weeks
-	layout := "2006-01-02"
-
-	weeks, err := strconv.Atoi(weeksStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid weeks format"})
+	weeks, ok := statistics.IntParam(c, "weeks", 12, 1, 520) // Default to 12 weeks
+	if !ok {
 		return
 	}
 
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.AddDate(0, 0, -7*weeks) // Default start date based on number of weeks
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	// The default start date is based on the number of weeks
+	params, ok := statistics.ParseParams(c, time.Duration(weeks)*7*24*time.Hour)
+	if !ok {
+		return
 	}
 
-	cohortData := statistics.GetCohortData(start, end, site, weeks)
+	cohortData := statistics.GetCohortData(params.Scope(), weeks)
 
 	c.JSON(http.StatusOK, cohortData)
 }
 
 func getAverageJourney(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	startPage := c.Query("start_page") // New parameter
-	endPage := c.Query("end_page")     // New parameter
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour) // Default to last 24 hours
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 24*time.Hour) // Default to last 24 hours
+	if !ok {
+		return
 	}
+	startPage := c.Query("start_page")
+	endPage := c.Query("end_page")
 
-	sankeyData := statistics.GetAverageJourney(start, end, site, startPage, endPage) // Pass new parameters
+	sankeyData := statistics.GetAverageJourney(params.Scope(), startPage, endPage)
 	c.JSON(http.StatusOK, sankeyData)
 }
 
 func getUniquePages(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour) // Default to last 24 hours
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 24*time.Hour) // Default to last 24 hours
+	if !ok {
+		return
 	}
 
-	pages, err := statistics.GetAllUniquePages(site, start, end)
+	pages, err := statistics.GetAllUniquePages(params.Scope())
 	if err != nil {
 		log.Println("Error getting unique pages:", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -283,65 +313,30 @@ func getUniquePages(c *gin.Context) {
 }
 
 func getBounceRate(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour)
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
 	}
 
-	bounceRate := statistics.GetBounceRate(start, end, site)
+	bounceRate := statistics.GetBounceRate(params.Scope())
 
 	response := structs.BounceRateResponse{BounceRate: bounceRate}
+	if scope, ok := params.ComparisonScope(); ok {
+		response.Comparison = statistics.NewComparison(scope,
+			map[string]float64{"bounceRate": bounceRate},
+			map[string]float64{"bounceRate": statistics.GetBounceRate(scope)})
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 func getTrafficByDayOfWeek(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.AddDate(0, 0, -7) // Default to last 7 days
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 7*24*time.Hour) // Default to last 7 days
+	if !ok {
+		return
 	}
 
-	traffic, err := statistics.GetTrafficByDayOfWeek(site, start, end)
+	traffic, err := statistics.GetTrafficByDayOfWeek(params.Scope())
 	if err != nil {
 		log.Println("Error getting traffic by day of week:", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -351,32 +346,12 @@ func getTrafficByDayOfWeek(c *gin.Context) {
 }
 
 func getTrafficByHourOfDay(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour) // Default to last 24 hours
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	params, ok := statistics.ParseParams(c, 24*time.Hour) // Default to last 24 hours
+	if !ok {
+		return
 	}
 
-	traffic, err := statistics.GetTrafficByHourOfDay(site, start, end)
+	traffic, err := statistics.GetTrafficByHourOfDay(params.Scope())
 	if err != nil {
 		log.Println("Error getting traffic by hour of day:", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -386,40 +361,119 @@ func getTrafficByHourOfDay(c *gin.Context) {
 }
 
 func getArchetypes(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	site := c.Query("site")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
+	params, ok := statistics.ParseParams(c, 30*24*time.Hour) // Default to last 30 days
+	if !ok {
+		return
+	}
+
+	archetypes, err := analysis.GetArchetypes(params.Scope())
+	if err != nil {
+		log.Println("Error getting archetypes:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, archetypes)
+}
+
+// getAcquisitionReport returns a handler for the top sources, mediums or campaigns report.
+func getAcquisitionReport(dimension string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, ok := statistics.ParseParams(c, 24*time.Hour)
+		if !ok {
+			return
+		}
+		limit, ok := statistics.IntParam(c, "limit", 20, 1, 1000)
+		if !ok {
 			return
 		}
-		end = t
-	}
 
-	start := end.AddDate(0, -1, 0) // Default to last month
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
+		rows, err := statistics.GetAcquisition(dimension, params.Scope(), limit)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+			log.Println("Error getting acquisition report:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		start = t
+		c.JSON(http.StatusOK, rows)
 	}
+}
 
-	archetypes, err := analysis.GetArchetypes(site, start, end)
+func getEntryPages(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	limit, ok := statistics.IntParam(c, "limit", 20, 1, 1000)
+	if !ok {
+		return
+	}
+
+	rows, err := statistics.GetEntryPages(params.Scope(), limit)
 	if err != nil {
-		log.Println("Error getting archetypes:", err)
+		log.Println("Error getting entry pages:", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.JSON(http.StatusOK, archetypes)
+	c.JSON(http.StatusOK, rows)
+}
+
+func getExitPages(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	limit, ok := statistics.IntParam(c, "limit", 20, 1, 1000)
+	if !ok {
+		return
+	}
+
+	rows, err := statistics.GetExitPages(params.Scope(), limit)
+	if err != nil {
+		log.Println("Error getting exit pages:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, rows)
 }
 
+// getFunnel counts the sessions that went through the step parameters in
+// order, see statistics.GetFunnel.
+func getFunnel(c *gin.Context) {
+	params, ok := statistics.ParseParams(c, 7*24*time.Hour) // Default to last 7 days
+	if !ok {
+		return
+	}
+	steps, err := statistics.ParseFunnelSteps(c.QueryArray("step"))
+	if err != nil {
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "step", err.Error())
+		return
+	}
+
+	var window time.Duration
+	if value := c.Query("window"); value != "" {
+		if window, err = time.ParseDuration(value); err != nil || window <= 0 {
+			statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "window", "Invalid window, use a positive duration like 30m or 2h")
+			return
+		}
+	}
+
+	var strict bool
+	switch c.DefaultQuery("order", "loose") {
+	case "loose":
+	case "strict":
+		strict = true
+	default:
+		statistics.AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "order", "Invalid order, use loose or strict")
+		return
+	}
+
+	funnel, err := statistics.GetFunnel(params.Scope(), steps, window, strict)
+	if err != nil {
+		log.Println("Error getting funnel:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, funnel)
+}
 
 func Server() {
 	router := gin.Default()
@@ -436,31 +490,84 @@ func Server() {
 	router.Use(CORSMiddleware())
 
 	router.GET(prefix+"/put-traffic", userTraffic)
-
-	router.POST(prefix+"/traffic", traffic)
-
-	router.POST(prefix+"/sites", statistics.GetUsersByPages)
-
-	router.POST(prefix+"/graph", statistics.GetTrafficStats)
-
-	router.POST(prefix+"/active", statistics.GetActiveUsers)
-
-	router.POST(prefix+"/time", statistics.GetTimeOnTheSite)
-
-	router.POST(prefix+"/get-sites", getSites)
-
-	router.POST(prefix+"/get-locations", getLocations)
-
-	router.GET(prefix+"/bounce-rate", getBounceRate)
-
-	router.POST(prefix+"/cohort", getCohortData)
-
-	router.POST(prefix+"/average-journey", getAverageJourney)
-
-	router.GET(prefix+"/statistics/traffic-by-day-of-week", getTrafficByDayOfWeek)
-	router.GET(prefix+"/statistics/traffic-by-hour-of-day", getTrafficByHourOfDay)
-	router.GET(prefix+"/statistics/unique-pages", getUniquePages)
-	router.GET(prefix+"/statistics/archetypes", getArchetypes)
+	router.POST(prefix+"/put-traffic", userTraffic) // navigator.sendBeacon only sends POST
+	router.POST(prefix+"/put-traffic/batch", userTrafficBatch)
+	router.POST(prefix+"/put-event", putEvent)
+	router.GET(prefix+"/pixel.gif", pixelTraffic)
+	router.GET(prefix+"/tracker.js", tracker.Serve)
+	router.GET(prefix+"/tracker/v1.js", tracker.Serve)
+
+	router.POST(prefix+"/auth/login", auth.LoginHandler)
+	router.POST(prefix+"/auth/refresh", auth.RefreshHandler)
+
+	// Every read endpoint requires a bearer token and viewer access to the
+	// requested site
+	api := router.Group("", auth.Middleware(), access.Middleware())
+
+	api.POST(prefix+"/traffic", traffic)
+
+	api.POST(prefix+"/sites", statistics.GetUsersByPages)
+	api.POST(prefix+"/browsers", statistics.GetUsersByClient("browser"))
+	api.POST(prefix+"/operating-systems", statistics.GetUsersByClient("os"))
+	api.POST(prefix+"/devices", statistics.GetUsersByClient("device"))
+	api.POST(prefix+"/tracking-sources", statistics.GetUsersByClient("source"))
+
+	api.POST(prefix+"/graph", statistics.GetTrafficStats)
+
+	api.POST(prefix+"/active", statistics.GetActiveUsers)
+	api.POST(prefix+"/live/token", getLiveToken)
+
+	api.POST(prefix+"/time", statistics.GetTimeOnTheSite)
+
+	api.POST(prefix+"/get-sites", getSites)
+
+	api.POST(prefix+"/get-locations", getLocations)
+
+	api.GET(prefix+"/bounce-rate", getBounceRate)
+
+	api.POST(prefix+"/cohort", getCohortData)
+
+	api.POST(prefix+"/average-journey", getAverageJourney)
+
+	api.GET(prefix+"/statistics/traffic-by-day-of-week", getTrafficByDayOfWeek)
+	api.GET(prefix+"/statistics/traffic-by-hour-of-day", getTrafficByHourOfDay)
+	api.GET(prefix+"/statistics/unique-pages", getUniquePages)
+	api.GET(prefix+"/statistics/archetypes", getArchetypes)
+	api.GET(prefix+"/statistics/sources", getAcquisitionReport("source"))
+	api.GET(prefix+"/statistics/mediums", getAcquisitionReport("medium"))
+	api.GET(prefix+"/statistics/campaigns", getAcquisitionReport("campaign"))
+	api.GET(prefix+"/statistics/entry-pages", getEntryPages)
+	api.GET(prefix+"/statistics/exit-pages", getExitPages)
+	api.GET(prefix+"/statistics/events", getEventCounts)
+	api.GET(prefix+"/statistics/events/properties", getEventPropertyBreakdown)
+	api.GET(prefix+"/statistics/funnel", getFunnel)
+	api.GET(prefix+"/statistics/goals", getGoalConversions)
+
+	// EventSource cannot send headers, the stream also takes a stream token
+	router.GET(prefix+"/live", auth.StreamMiddleware(), access.Middleware(), getLiveStream)
+
+	// Users, organizations, sites and memberships
+	account := router.Group("", auth.Middleware())
+	account.GET(prefix+"/me", getMe)
+	account.POST(prefix+"/users", access.RequireSuperuser(), createUser)
+	account.POST(prefix+"/organizations", access.RequireSuperuser(), createOrganization)
+	account.POST(prefix+"/organizations/:id/members", addOrganizationMember)
+	account.DELETE(prefix+"/organizations/:id/members/:userId", removeOrganizationMember)
+	account.PUT(prefix+"/organizations/:id/sites/:site", access.RequireSuperuser(), assignSiteToOrganization)
+	account.GET(prefix+"/sites", listSites)
+	account.PUT(prefix+"/sites/:site", createSite)
+	account.GET(prefix+"/sites/:site", access.RequireSiteRole(access.RoleViewer), getSite)
+	account.PATCH(prefix+"/sites/:site", access.RequireSiteRole(access.RoleEditor), updateSite)
+	account.DELETE(prefix+"/sites/:site", access.RequireSiteRole(access.RoleAdmin), deleteSite)
+	account.POST(prefix+"/sites/:site/archive", access.RequireSiteRole(access.RoleAdmin), archiveSite)
+	account.DELETE(prefix+"/sites/:site/archive", access.RequireSiteRole(access.RoleAdmin), restoreSite)
+	account.POST(prefix+"/sites/:site/members", access.RequireSiteRole(access.RoleAdmin), addSiteMember)
+	account.DELETE(prefix+"/sites/:site/members/:userId", access.RequireSiteRole(access.RoleAdmin), removeSiteMember)
+	account.GET(prefix+"/sites/:site/goals", access.RequireSiteRole(access.RoleViewer), listGoals)
+	account.POST(prefix+"/sites/:site/goals", access.RequireSiteRole(access.RoleEditor), createGoal)
+	account.PUT(prefix+"/sites/:site/goals/:id", access.RequireSiteRole(access.RoleEditor), updateGoal)
+	account.DELETE(prefix+"/sites/:site/goals/:id", access.RequireSiteRole(access.RoleEditor), deleteGoal)
+	account.GET(prefix+"/admin/storage", access.RequireSuperuser(), getStorageStatus)
 
 	// Health check endpoint
 	router.GET(prefix+"/health", func(c *gin.Context) {
@@ -469,9 +576,29 @@ func Server() {
 
 	log.Println("prefix", prefix)
 	log.Print("Starting server on port " + port)
-	err := router.Run("0.0.0.0:" + port)
-	if (err) == nil {
-		log.Println("Failed to start server", "error", err)
-		panic(err)
+
+	srv := &http.Server{
+		Addr:    "0.0.0.0:" + port,
+		Handler: router,
+	}
+	srv.RegisterOnShutdown(closeStreams)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("Failed to start server", "error", err)
+			panic(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Server forced to shut down:", err)
 	}
 }
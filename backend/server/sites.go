@@ -0,0 +1,252 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"statistics/access"
+	"statistics/auth"
+	"statistics/database"
+	"statistics/sessions"
+	"statistics/sites"
+	"statistics/structs"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// siteWithRole is a registered site together with the role of the caller on it.
+type siteWithRole struct {
+	structs.Site
+	Role string `json:"role"`
+}
+
+// withRole hides the ingest key from viewers, it is only needed to set up tracking.
+func withRole(site structs.Site, role string) siteWithRole {
+	if !access.HasRole(role, access.RoleEditor) {
+		site.IngestKey = ""
+	}
+	return siteWithRole{Site: site, Role: role}
+}
+
+// loadSite reads the site of the :site path parameter, bypassing the settings
+// cache. It writes the error response itself.
+func loadSite(c *gin.Context) (*structs.Site, bool) {
+	var site structs.Site
+	if err := database.Session.Where("name = ?", c.Param("site")).First(&site).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown site"})
+		} else {
+			log.Println("Error fetching site:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &site, true
+}
+
+// listSites returns the registered sites visible to the caller, archived ones included.
+func listSites(c *gin.Context) {
+	visible, _, err := access.VisibleSites(auth.UserId(c))
+	if err != nil {
+		log.Println("Error fetching visible sites:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	roles := make(map[string]string, len(visible))
+	names := make([]string, 0, len(visible))
+	for _, site := range visible {
+		roles[site.Site] = site.Role
+		names = append(names, site.Site)
+	}
+
+	var rows []structs.Site
+	if err := database.Session.Where("name IN ?", names).Order("name ASC").Find(&rows).Error; err != nil {
+		log.Println("Error fetching sites:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]siteWithRole, 0, len(rows))
+	for _, site := range rows {
+		result = append(result, withRole(site, roles[site.Name]))
+	}
+	c.JSON(http.StatusOK, gin.H{"sites": result})
+}
+
+func getSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	role, err := access.SiteRole(auth.UserId(c), site.Name)
+	if err != nil {
+		log.Println("Error checking site access:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, withRole(*site, role))
+}
+
+// createSite registers the site of the :site path parameter. Superusers may
+// create any site, organization admins sites inside their organization.
+func createSite(c *gin.Context) {
+	var req structs.SiteRequest
+	// The body is optional, a site can be created with the defaults
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site format"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Param("site"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing site name"})
+		return
+	}
+
+	userId := auth.UserId(c)
+	if req.OrganizationId != nil {
+		role, err := access.OrganizationRole(userId, *req.OrganizationId)
+		if err != nil {
+			log.Println("Error checking organization access:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !access.HasRole(role, access.RoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The admin role is required in this organization"})
+			return
+		}
+	} else if !access.IsSuperuser(userId) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only superusers can create sites outside an organization"})
+		return
+	}
+
+	site := structs.Site{Name: name, Enabled: true, OrganizationId: req.OrganizationId}
+	if err := sites.ApplySettings(&site, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := sites.Create(&site); err != nil {
+		if errors.Is(err, sites.ErrSiteExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Println("Error creating site:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, withRole(site, access.RoleAdmin))
+}
+
+// updateSite changes the settings of a site. Editors may change the settings,
+// renaming needs the admin role. The organization is changed through
+// PUT /organizations/:id/sites/:site.
+func updateSite(c *gin.Context) {
+	var req structs.SiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid site format"})
+		return
+	}
+
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	sessionTimeout := site.SessionTimeout
+	if err := sites.ApplySettings(site, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := access.SiteRole(auth.UserId(c), site.Name)
+	if err != nil {
+		log.Println("Error checking site access:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	newName := ""
+	if req.Name != nil && strings.TrimSpace(*req.Name) != site.Name {
+		if !access.HasRole(role, access.RoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The admin role is required to rename a site"})
+			return
+		}
+		newName = strings.TrimSpace(*req.Name)
+		if newName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing site name"})
+			return
+		}
+	}
+
+	// Rename first, a taken name must not leave the other changes half applied
+	if newName != "" {
+		if err := sites.Rename(site, newName); err != nil {
+			if errors.Is(err, sites.ErrSiteExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			log.Println("Error renaming site:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		site.Name = newName
+	}
+	if err := sites.Save(site); err != nil {
+		log.Println("Error saving site:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if site.SessionTimeout != sessionTimeout {
+		// The stored sessions were split with the old timeout
+		go func(name string) {
+			if err := sessions.RebuildSite(name); err != nil {
+				log.Println("Error rebuilding sessions:", err)
+			}
+		}(site.Name)
+	}
+	c.JSON(http.StatusOK, withRole(*site, role))
+}
+
+func archiveSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	if err := sites.Archive(site); err != nil {
+		log.Println("Error archiving site:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func restoreSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	if err := sites.Restore(site); err != nil {
+		log.Println("Error restoring site:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// deleteSite removes a site together with all of its stored data.
+func deleteSite(c *gin.Context) {
+	site, ok := loadSite(c)
+	if !ok {
+		return
+	}
+	if err := sites.Delete(site); err != nil {
+		log.Println("Error deleting site:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
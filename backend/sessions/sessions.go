@@ -0,0 +1,292 @@
+// Package sessions maintains the sessions table: every page view of
+// web_metrics grouped into visits, so reports over long ranges read one row
+// per visit instead of every hit.
+//
+// A background job follows web_metrics by id. For every visitor with new page
+// views it rebuilds the sessions that the new hits can extend or merge, late
+// hits from offline batches included. Ids are taken when a flush starts, not
+// when it commits, so a run also rescans the rows of the last
+// SESSIONS_OVERLAP: concurrent flushes of several instances can commit a lower
+// id after a higher one was processed.
+package sessions
+
+import (
+	"fmt"
+	"log"
+	"statistics/config"
+	"statistics/database"
+	"statistics/sites"
+	"statistics/structs"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockId is the advisory lock that keeps backend instances from running the job at once.
+const lockId = 727003
+
+// ready reports that the sessions table covers every page view, see Ready.
+var ready atomic.Bool
+
+var stop = make(chan struct{})
+var done = make(chan struct{})
+
+// Ready reports whether the reports can read the sessions table. It is false
+// until the first run of the job caught up with web_metrics.
+func Ready() bool {
+	return ready.Load()
+}
+
+// Start runs the job every SESSIONS_INTERVAL (default 1m). A run processes
+// SESSIONS_CHUNK page views (default 50000) per transaction until it caught
+// up, rescanning the page views of the last SESSIONS_OVERLAP (default 2m).
+func Start() {
+	interval := config.Duration("SESSIONS_INTERVAL", time.Minute)
+	chunk := config.Int("SESSIONS_CHUNK", 50000)
+	overlap := config.Duration("SESSIONS_OVERLAP", 2*time.Minute)
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run(chunk, overlap)
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Sessions job started (interval: %s, chunk: %d, overlap: %s)", interval, chunk, overlap)
+}
+
+// Close stops the job after the run in progress.
+func Close() {
+	close(stop)
+	<-done
+}
+
+// run materializes page views until it caught up or the job is stopping.
+func run(chunk int, overlap time.Duration) {
+	for first := true; ; first = false {
+		caughtUp, err := step(chunk, overlap, first)
+		if err != nil {
+			log.Println("Error materializing sessions:", err)
+			return
+		}
+		if caughtUp {
+			break
+		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+	}
+
+	var cursor structs.SessionCursor
+	if err := database.Session.Limit(1).Find(&cursor).Error; err != nil {
+		log.Println("Error reading the sessions cursor:", err)
+		return
+	}
+	ready.Store(cursor.CaughtUp)
+}
+
+// step processes the next chunk of page views and reports whether it reached
+// the newest one. Another instance holding the lock counts as caught up.
+//
+// The first step of a run rescans from RescanHitId, the position of the cursor
+// at least overlap ago. A row committed within overlap after its id was
+// passed is processed then, rebuilding sessions again is harmless.
+func step(chunk int, overlap time.Duration, rescan bool) (bool, error) {
+	caughtUp := true
+	err := database.Session.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", lockId).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		var cursor structs.SessionCursor
+		if err := tx.FirstOrCreate(&cursor, structs.SessionCursor{Id: 1}).Error; err != nil {
+			return fmt.Errorf("failed to read cursor: %w", err)
+		}
+
+		var maxId uint
+		if err := tx.Raw("SELECT COALESCE(MAX(id), 0) FROM web_metrics").Scan(&maxId).Error; err != nil {
+			return fmt.Errorf("failed to read newest page view: %w", err)
+		}
+
+		upto := cursor.LastHitId + uint(chunk)
+		if upto >= maxId {
+			upto = maxId
+		} else {
+			caughtUp = false
+		}
+
+		from := cursor.LastHitId
+		if rescan && cursor.RescanHitId < from {
+			from = cursor.RescanHitId
+		}
+		if upto > from {
+			changes := `
+				SELECT COALESCE(site, ''), session_id AS visitor_id, MIN(timestamp) AS since
+				FROM web_metrics
+				WHERE id > ? AND id <= ? AND is_bot = false
+				GROUP BY COALESCE(site, ''), session_id`
+			if err := rebuild(tx, changes, from, upto); err != nil {
+				return err
+			}
+		}
+
+		if rescan && time.Since(cursor.CheckpointAt) >= overlap {
+			cursor.RescanHitId, cursor.CheckpointHitId, cursor.CheckpointAt = cursor.CheckpointHitId, upto, time.Now()
+		}
+		cursor.LastHitId, cursor.CaughtUp = upto, caughtUp
+		return tx.Save(&cursor).Error
+	})
+	return caughtUp, err
+}
+
+// RebuildSite materializes the sessions of a site again, e.g. after its
+// session timeout changed. Sessions older than the page views kept by the
+// retention policy stay as they are.
+func RebuildSite(site string) error {
+	return database.Session.Transaction(func(tx *gorm.DB) error {
+		// Waits for a run of the job, it could write sessions of the site meanwhile
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockId).Error; err != nil {
+			return err
+		}
+		changes := `
+			SELECT site, session_id AS visitor_id, MIN(timestamp) AS since
+			FROM web_metrics
+			WHERE site = ? AND is_bot = false
+			GROUP BY site, session_id`
+		return rebuild(tx, changes, site)
+	})
+}
+
+// rebuild materializes the sessions of the visitors of the changes query
+// (site, visitor_id, since) from since on, site ” standing for none. A
+// visitor ID used on several sites has separate sessions on each. Sessions that new page views can extend
+// or merge, the ones ending within the session timeout before since or
+// later, are deleted first and their page views processed again.
+func rebuild(tx *gorm.DB, changes string, params ...interface{}) error {
+	timeout := "COALESCE(sites.session_timeout, " + strconv.Itoa(sites.DefaultSessionTimeout) + ") * INTERVAL '1 minute'"
+
+	if err := tx.Exec("CREATE TEMPORARY TABLE session_changes (site varchar(255), visitor_id varchar(255), since timestamptz NOT NULL, PRIMARY KEY (site, visitor_id)) ON COMMIT DROP").Error; err != nil {
+		return fmt.Errorf("failed to create changed visitors: %w", err)
+	}
+	if err := tx.Exec("INSERT INTO session_changes (site, visitor_id, since) "+changes, params...).Error; err != nil {
+		return fmt.Errorf("failed to collect changed visitors: %w", err)
+	}
+
+	statements := []struct {
+		name  string
+		query string
+	}{
+		{"extend the rebuilt range", `
+			UPDATE session_changes SET since = LEAST(session_changes.since, affected.started_at)
+			FROM (
+				SELECT session_changes.site, sessions.visitor_id, MIN(sessions.started_at) AS started_at
+				FROM sessions
+				JOIN session_changes ON session_changes.visitor_id = sessions.visitor_id
+					AND session_changes.site = COALESCE(sessions.site, '')
+				LEFT JOIN sites ON sites.name = sessions.site
+				WHERE sessions.ended_at >= session_changes.since - ` + timeout + `
+				GROUP BY session_changes.site, sessions.visitor_id
+			) AS affected
+			WHERE affected.visitor_id = session_changes.visitor_id AND affected.site = session_changes.site`},
+		{"delete affected sessions", `
+			DELETE FROM sessions USING session_changes
+			WHERE sessions.visitor_id = session_changes.visitor_id
+				AND COALESCE(sessions.site, '') = session_changes.site
+				AND sessions.ended_at >= session_changes.since`},
+		{"insert sessions", `
+			INSERT INTO sessions (visitor_id, site, started_at, ended_at, duration, active_time, page_count, unique_pages,
+				entry_page, exit_page, country_code, country_name, referrer_source, bounce)
+			SELECT
+				session_id,
+				site,
+				MIN(timestamp),
+				MAX(timestamp),
+				EXTRACT(EPOCH FROM MAX(timestamp) - MIN(timestamp)),
+				COALESCE(SUM(minutes_diff) FILTER (WHERE minutes_diff <= 5), 0),
+				COUNT(*),
+				COUNT(DISTINCT page),
+				(ARRAY_AGG(page ORDER BY timestamp, id))[1],
+				(ARRAY_AGG(page ORDER BY timestamp DESC, id DESC))[1],
+				(ARRAY_AGG(country_code ORDER BY timestamp, id))[1],
+				(ARRAY_AGG(country_name ORDER BY timestamp, id))[1],
+				(ARRAY_AGG(referrer_source ORDER BY timestamp, id))[1],
+				COUNT(*) = 1
+			FROM (
+				SELECT visits.*,
+					EXTRACT(EPOCH FROM timestamp - LAG(timestamp) OVER (PARTITION BY session_id, site, visit ORDER BY timestamp, id)) / 60.0 AS minutes_diff
+				FROM (
+					SELECT gaps.*, SUM(new_session) OVER (PARTITION BY session_id, site ORDER BY timestamp, id) AS visit
+					FROM (
+						SELECT web_metrics.id, web_metrics.timestamp, web_metrics.session_id, web_metrics.site, web_metrics.page,
+							web_metrics.country_code, web_metrics.country_name, web_metrics.referrer_source,
+							CASE WHEN web_metrics.timestamp - LAG(web_metrics.timestamp) OVER (PARTITION BY web_metrics.session_id, web_metrics.site ORDER BY web_metrics.timestamp, web_metrics.id)
+								> ` + timeout + `
+							THEN 1 ELSE 0 END AS new_session
+						FROM web_metrics
+						JOIN session_changes ON session_changes.visitor_id = web_metrics.session_id
+							AND session_changes.site = COALESCE(web_metrics.site, '')
+						LEFT JOIN sites ON sites.name = web_metrics.site
+						WHERE web_metrics.timestamp >= session_changes.since AND web_metrics.is_bot = false
+					) AS gaps
+				) AS visits
+			) AS hits
+			GROUP BY session_id, site, visit`},
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement.query).Error; err != nil {
+			return fmt.Errorf("failed to %s: %w", statement.name, err)
+		}
+	}
+
+	// Continuous aggregates follow the sessions table by themselves
+	if database.RollupStorage() == database.RollupTable {
+		return refreshRollups(tx)
+	}
+	return nil
+}
+
+// refreshRollups aggregates the buckets of the plain rollup tables again from
+// the first rebuilt session of each site on.
+func refreshRollups(tx *gorm.DB) error {
+	err := tx.Exec(`
+		CREATE TEMPORARY TABLE rollup_changes ON COMMIT DROP AS
+		SELECT sessions.site, MIN(session_changes.since) AS since
+		FROM session_changes
+		JOIN sessions ON sessions.visitor_id = session_changes.visitor_id
+			AND COALESCE(sessions.site, '') = session_changes.site
+			AND sessions.started_at >= session_changes.since
+		GROUP BY sessions.site`).Error
+	if err != nil {
+		return fmt.Errorf("failed to collect changed rollup buckets: %w", err)
+	}
+
+	for _, rollup := range database.Rollups {
+		start := "date_trunc('" + rollup.Unit + "', rollup_changes.since AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'"
+		err := tx.Exec(`
+			DELETE FROM ` + rollup.Table + ` USING rollup_changes
+			WHERE ` + rollup.Table + `.site = rollup_changes.site AND ` + rollup.Table + `.bucket >= ` + start).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete changed buckets of %s: %w", rollup.Table, err)
+		}
+		changed := "EXISTS (SELECT 1 FROM rollup_changes WHERE rollup_changes.site = sessions.site AND sessions.started_at >= " + start + ")"
+		if err := tx.Exec("INSERT INTO " + rollup.Table + " " + database.RollupQuery(rollup, changed)).Error; err != nil {
+			return fmt.Errorf("failed to aggregate changed buckets of %s: %w", rollup.Table, err)
+		}
+	}
+	return nil
+}
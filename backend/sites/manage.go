@@ -0,0 +1,179 @@
+package sites
+
+import (
+	"errors"
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSiteExists is returned when a site is created or renamed to a name that is taken.
+var ErrSiteExists = errors.New("site already exists")
+
+// exists reports whether a site row with the name exists, archived or not.
+func exists(tx *gorm.DB, name string) (bool, error) {
+	var count int64
+	if err := tx.Model(&structs.Site{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check site %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// Create registers a new site with a fresh ingest key. Without allowed origins
+// the site accepts its own domain and its subdomains.
+func Create(site *structs.Site) error {
+	taken, err := exists(database.Session, site.Name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrSiteExists
+	}
+
+	key, err := GenerateIngestKey()
+	if err != nil {
+		return err
+	}
+	site.IngestKey = key
+	if site.AllowedOrigins == "" {
+		site.AllowedOrigins = defaultOrigins(site.Name)
+	}
+	if site.Timezone == "" {
+		site.Timezone = DefaultTimezone
+	}
+	if site.Currency == "" {
+		site.Currency = DefaultCurrency
+	}
+	if site.SessionTimeout == 0 {
+		site.SessionTimeout = DefaultSessionTimeout
+	}
+
+	enabled := site.Enabled
+	if err := database.Session.Create(site).Error; err != nil {
+		return fmt.Errorf("failed to create site %s: %w", site.Name, err)
+	}
+	// GORM skips zero values of fields with a database default, false included
+	if !enabled {
+		if err := database.Session.Model(site).Update("enabled", false).Error; err != nil {
+			return fmt.Errorf("failed to disable site %s: %w", site.Name, err)
+		}
+	}
+	Invalidate(site.Name)
+	return nil
+}
+
+// Save stores changed settings of a site.
+func Save(site *structs.Site) error {
+	if err := database.Session.Save(site).Error; err != nil {
+		return fmt.Errorf("failed to save site %s: %w", site.Name, err)
+	}
+	Invalidate(site.Name)
+	return nil
+}
+
+// Rename changes the name of a site together with the site column of its
+// stored page views and events, so the history stays with the site.
+func Rename(site *structs.Site, name string) error {
+	oldName := site.Name
+	err := database.Session.Transaction(func(tx *gorm.DB) error {
+		taken, err := exists(tx, name)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrSiteExists
+		}
+		if err := tx.Model(site).Update("name", name).Error; err != nil {
+			return fmt.Errorf("failed to rename site: %w", err)
+		}
+		if err := database.DecompressSite(tx, oldName); err != nil {
+			return err
+		}
+		if err := tx.Model(&structs.WebMetric{}).Where("site = ?", oldName).Update("site", name).Error; err != nil {
+			return fmt.Errorf("failed to move page views: %w", err)
+		}
+		if err := tx.Model(&structs.Event{}).Where("site = ?", oldName).Update("site", name).Error; err != nil {
+			return fmt.Errorf("failed to move events: %w", err)
+		}
+		if err := tx.Model(&structs.Session{}).Where("site = ?", oldName).Update("site", name).Error; err != nil {
+			return fmt.Errorf("failed to move sessions: %w", err)
+		}
+		if database.RollupStorage() == database.RollupTable {
+			for _, rollup := range database.Rollups {
+				if err := tx.Exec("UPDATE "+rollup.Table+" SET site = ? WHERE site = ?", name, oldName).Error; err != nil {
+					return fmt.Errorf("failed to move %s: %w", rollup.Table, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	Invalidate(oldName)
+	Invalidate(name)
+	return nil
+}
+
+// Archive stops a site from accepting hits while keeping its data readable.
+func Archive(site *structs.Site) error {
+	now := time.Now()
+	if err := database.Session.Model(site).Update("archived_at", &now).Error; err != nil {
+		return fmt.Errorf("failed to archive site %s: %w", site.Name, err)
+	}
+	Invalidate(site.Name)
+	return nil
+}
+
+// Restore makes an archived site accept hits again.
+func Restore(site *structs.Site) error {
+	if err := database.Session.Model(site).Update("archived_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to restore site %s: %w", site.Name, err)
+	}
+	Invalidate(site.Name)
+	return nil
+}
+
+// Delete removes a site with its page views, events and members. Without the
+// data, the site would be listed by Unregistered.
+func Delete(site *structs.Site) error {
+	err := database.Session.Transaction(func(tx *gorm.DB) error {
+		if err := database.DecompressSite(tx, site.Name); err != nil {
+			return err
+		}
+		if err := tx.Where("site = ?", site.Name).Delete(&structs.WebMetric{}).Error; err != nil {
+			return fmt.Errorf("failed to delete page views: %w", err)
+		}
+		if err := tx.Where("site = ?", site.Name).Delete(&structs.Event{}).Error; err != nil {
+			return fmt.Errorf("failed to delete events: %w", err)
+		}
+		if err := tx.Where("site = ?", site.Name).Delete(&structs.Session{}).Error; err != nil {
+			return fmt.Errorf("failed to delete sessions: %w", err)
+		}
+		if database.RollupStorage() == database.RollupTable {
+			for _, rollup := range database.Rollups {
+				if err := tx.Exec("DELETE FROM "+rollup.Table+" WHERE site = ?", site.Name).Error; err != nil {
+					return fmt.Errorf("failed to delete %s: %w", rollup.Table, err)
+				}
+			}
+		}
+		if err := tx.Where("site_id = ?", site.Id).Delete(&structs.SiteMember{}).Error; err != nil {
+			return fmt.Errorf("failed to delete site members: %w", err)
+		}
+		if err := tx.Where("site_id = ?", site.Id).Delete(&structs.Goal{}).Error; err != nil {
+			return fmt.Errorf("failed to delete goals: %w", err)
+		}
+		if err := tx.Delete(site).Error; err != nil {
+			return fmt.Errorf("failed to delete site: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	Invalidate(site.Name)
+	return nil
+}
@@ -0,0 +1,189 @@
+package sites
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"statistics/database"
+	"statistics/structs"
+	"strings"
+)
+
+// Reasons a hit is rejected by Authorize
+var (
+	ErrUnknownSite      = errors.New("unknown site")
+	ErrSiteDisabled     = errors.New("site is disabled")
+	ErrSiteArchived     = errors.New("site is archived")
+	ErrInvalidKey       = errors.New("invalid ingest key")
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// Authorize decides whether a hit for a site may be stored. A valid ingest key
+// is always enough; without a key the request origin (the Origin header, or
+// the host of the referrer) must be on the site's allowlist.
+func Authorize(name, key, origin string) error {
+	site := Get(name)
+	if site == nil {
+		return ErrUnknownSite
+	}
+	if site.ArchivedAt != nil {
+		return ErrSiteArchived
+	}
+	if !site.Enabled {
+		return ErrSiteDisabled
+	}
+
+	if key != "" {
+		if site.IngestKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(site.IngestKey)) != 1 {
+			return ErrInvalidKey
+		}
+		return nil
+	}
+
+	if origin == "" {
+		if site.AllowedOrigins == "" {
+			return ErrInvalidKey
+		}
+		return ErrOriginNotAllowed
+	}
+	if !OriginAllowed(site.AllowedOrigins, origin) {
+		return ErrOriginNotAllowed
+	}
+	return nil
+}
+
+// OriginAllowed reports whether the host of origin matches the comma-separated
+// allowlist. Entries may be hosts or full origins, "*.example.com" matches
+// every subdomain of example.com.
+func OriginAllowed(allowedOrigins, origin string) bool {
+	host := hostOf(origin)
+	if host == "" {
+		return false
+	}
+
+	for _, entry := range strings.Split(allowedOrigins, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if strings.HasPrefix(entry, "*.") {
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+			continue
+		}
+		if hostOf(entry) == host {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOf(origin string) string {
+	origin = strings.TrimSpace(origin)
+	if !strings.Contains(origin, "://") {
+		origin = "http://" + origin
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// GenerateIngestKey returns a new random ingest key.
+func GenerateIngestKey() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// List returns the names of the enabled sites that are not archived.
+func List() ([]string, error) {
+	var names []string
+	err := database.Session.Model(&structs.Site{}).
+		Where("enabled = ? AND archived_at IS NULL", true).
+		Order("name ASC").
+		Pluck("name", &names).Error
+	return names, err
+}
+
+// UnregisteredSite is a site with page views from before the registry.
+type UnregisteredSite struct {
+	Name      string
+	PageViews int64
+}
+
+// Unregistered lists the sites with page views but no row in the registry,
+// the most viewed first. It reads all of web_metrics, it is meant for the
+// one-off "sites unregistered" command.
+func Unregistered() ([]UnregisteredSite, error) {
+	var unregistered []UnregisteredSite
+	err := database.Session.Raw(`
+		SELECT site AS name, COUNT(*) AS page_views FROM web_metrics
+		WHERE site <> '' AND site NOT IN (SELECT name FROM sites)
+		GROUP BY site
+		ORDER BY page_views DESC, site
+	`).Scan(&unregistered).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unregistered sites: %w", err)
+	}
+	return unregistered, nil
+}
+
+// Register adds a site that already has traffic to the registry, so enabling
+// the registry does not cut off tracking that works today. It allows its
+// own domain and its subdomains as origins.
+func Register(name string) (*structs.Site, error) {
+	key, err := GenerateIngestKey()
+	if err != nil {
+		return nil, err
+	}
+	site := structs.Site{
+		Name:           name,
+		IngestKey:      key,
+		AllowedOrigins: defaultOrigins(name),
+		Enabled:        true,
+	}
+	if err := database.Session.Create(&site).Error; err != nil {
+		return nil, fmt.Errorf("failed to register site %s: %w", name, err)
+	}
+	Invalidate(name)
+	return &site, nil
+}
+
+// EnsureIngestKeys gives the registered sites without an ingest key one.
+func EnsureIngestKeys() error {
+	var keyless []structs.Site
+	if err := database.Session.Where("ingest_key = '' OR ingest_key IS NULL").Find(&keyless).Error; err != nil {
+		return fmt.Errorf("failed to query sites without ingest key: %w", err)
+	}
+	for _, site := range keyless {
+		key, err := GenerateIngestKey()
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"ingest_key": key}
+		if site.AllowedOrigins == "" {
+			updates["allowed_origins"] = defaultOrigins(site.Name)
+		}
+		if err := database.Session.Model(&site).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to set ingest key of site %s: %w", site.Name, err)
+		}
+		log.Println("Generated ingest key of site:", site.Name)
+	}
+	return nil
+}
+
+func defaultOrigins(name string) string {
+	return name + ", *." + strings.TrimPrefix(name, "www.")
+}
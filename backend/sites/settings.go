@@ -0,0 +1,141 @@
+package sites
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"statistics/structs"
+	"strings"
+	"time"
+)
+
+// Defaults of sites without their own settings
+const (
+	DefaultTimezone       = "UTC"
+	DefaultCurrency       = "EUR"
+	DefaultSessionTimeout = 30 // minutes
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Timezone returns the timezone reports of a site are bucketed in.
+func Timezone(name string) string {
+	if site := Get(name); site != nil && site.Timezone != "" {
+		return site.Timezone
+	}
+	return DefaultTimezone
+}
+
+// SessionTimeout returns the inactivity after which a new session of the site starts.
+func SessionTimeout(name string) time.Duration {
+	if site := Get(name); site != nil && site.SessionTimeout > 0 {
+		return time.Duration(site.SessionTimeout) * time.Minute
+	}
+	return DefaultSessionTimeout * time.Minute
+}
+
+// Excluded reports whether a hit from ip on page should not be stored because
+// of the excluded addresses or paths of the site.
+func Excluded(name, ip, page string) bool {
+	site := Get(name)
+	if site == nil {
+		return false
+	}
+	return ipExcluded(site.ExcludedIps, ip) || pathExcluded(site.ExcludedPaths, page)
+}
+
+func ipExcluded(excludedIps, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(excludedIps, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if excluded := net.ParseIP(entry); excluded != nil && excluded.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathExcluded(excludedPaths, page string) bool {
+	// The tracker sends the path alone, batch and hand-written clients can
+	// still send a query string, exclusions match the path only
+	path, _, _ := strings.Cut(page, "?")
+	for _, entry := range strings.Split(excludedPaths, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplySettings validates the settings of a request and copies them onto site.
+// The name and the organization are handled by the callers.
+func ApplySettings(site *structs.Site, req structs.SiteRequest) error {
+	if req.DisplayName != nil {
+		site.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			return errors.New("unknown timezone")
+		}
+		site.Timezone = *req.Timezone
+	}
+	if req.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyPattern.MatchString(currency) {
+			return errors.New("currency must be a three-letter ISO 4217 code")
+		}
+		site.Currency = currency
+	}
+	if req.AllowedOrigins != nil {
+		site.AllowedOrigins = strings.TrimSpace(*req.AllowedOrigins)
+	}
+	if req.ExcludedIps != nil {
+		for _, entry := range strings.Split(*req.ExcludedIps, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+				return errors.New("invalid excluded address: " + entry)
+			}
+		}
+		site.ExcludedIps = strings.TrimSpace(*req.ExcludedIps)
+	}
+	if req.ExcludedPaths != nil {
+		site.ExcludedPaths = strings.TrimSpace(*req.ExcludedPaths)
+	}
+	if req.SessionTimeout != nil {
+		if *req.SessionTimeout < 1 || *req.SessionTimeout > 24*60 {
+			return errors.New("session timeout must be between 1 and 1440 minutes")
+		}
+		site.SessionTimeout = *req.SessionTimeout
+	}
+	if req.Enabled != nil {
+		site.Enabled = *req.Enabled
+	}
+	if req.BotPolicy != nil {
+		if *req.BotPolicy != "" && *req.BotPolicy != BotPolicyFlag && *req.BotPolicy != BotPolicyDrop {
+			return errors.New("bot policy must be flag or drop")
+		}
+		site.BotPolicy = *req.BotPolicy
+	}
+	return nil
+}
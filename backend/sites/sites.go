@@ -0,0 +1,101 @@
+package sites
+
+import (
+	"log"
+	"os"
+	"statistics/database"
+	"statistics/structs"
+	"sync"
+	"time"
+)
+
+// Bot policies, chosen per site
+const (
+	BotPolicyFlag = "flag" // Store bot hits with is_bot = true, statistics exclude them
+	BotPolicyDrop = "drop" // Do not store bot hits at all
+)
+
+const cacheTTL = 30 * time.Second
+
+// missTTL is how long an unknown name is remembered, shorter than cacheTTL
+// so a site registered by another instance is picked up soon. At most
+// maxMisses names are kept, hits can name any site.
+const (
+	missTTL   = 5 * time.Second
+	maxMisses = 10000
+)
+
+type cacheEntry struct {
+	site    *structs.Site
+	fetched time.Time
+}
+
+var (
+	cacheMu sync.RWMutex
+	cache   = make(map[string]cacheEntry)
+	misses  = make(map[string]time.Time)
+)
+
+// Get returns the registered settings of a site, or nil if the site has no row.
+// Lookups are cached for a short time because they run on every tracked hit,
+// unknown names for an even shorter time.
+func Get(name string) *structs.Site {
+	cacheMu.RLock()
+	entry, ok := cache[name]
+	missed, isMiss := misses[name]
+	cacheMu.RUnlock()
+	if ok && time.Since(entry.fetched) < cacheTTL {
+		return entry.site
+	}
+	if isMiss && time.Since(missed) < missTTL {
+		return nil
+	}
+
+	var site structs.Site
+	result := database.Session.Where("name = ?", name).Limit(1).Find(&site)
+	if result.Error != nil {
+		log.Println("Error fetching site settings:", result.Error)
+		// Keep serving the previous value while the database is unavailable
+		if ok {
+			return entry.site
+		}
+		return nil
+	}
+	if result.RowsAffected == 0 {
+		cacheMu.Lock()
+		delete(cache, name)
+		if len(misses) >= maxMisses {
+			misses = make(map[string]time.Time)
+		}
+		misses[name] = time.Now()
+		cacheMu.Unlock()
+		return nil
+	}
+
+	cacheMu.Lock()
+	cache[name] = cacheEntry{site: &site, fetched: time.Now()}
+	delete(misses, name)
+	cacheMu.Unlock()
+	return &site
+}
+
+// Invalidate drops the cached settings of a site after it was changed, or
+// the cached miss of a name after it was registered.
+func Invalidate(name string) {
+	cacheMu.Lock()
+	delete(cache, name)
+	delete(misses, name)
+	cacheMu.Unlock()
+}
+
+// BotPolicy returns how bot traffic of a site is handled. Sites without their
+// own setting use BOT_POLICY, which defaults to flagging.
+func BotPolicy(name string) string {
+	if site := Get(name); site != nil && site.BotPolicy != "" {
+		return site.BotPolicy
+	}
+	if os.Getenv("BOT_POLICY") == BotPolicyDrop {
+		return BotPolicyDrop
+	}
+	return BotPolicyFlag
+}
@@ -0,0 +1,53 @@
+package statistics
+
+import (
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+)
+
+// acquisitionDimensions maps the report dimensions to the expression evaluated
+// on the first hit of every session.
+var acquisitionDimensions = map[string]string{
+	"source":   "COALESCE(utm_source, referrer_source, '(direct)')",
+	"medium":   "COALESCE(utm_medium, CASE WHEN referrer_source IS NOT NULL THEN 'referral' ELSE '(none)' END)",
+	"campaign": "COALESCE(utm_campaign, '(not set)')",
+}
+
+// GetAcquisition groups sessions by the source, medium or campaign of their
+// first hit and reports the unique sessions and bounce rate of each group.
+// Bounces use the same definition as GetBounceRate.
+func GetAcquisition(dimension string, scope Scope, limit int) ([]structs.AcquisitionRow, error) {
+	expression, ok := acquisitionDimensions[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown acquisition dimension: %s", dimension)
+	}
+
+	hits, params := scope.SessionHits()
+	params = append(params, limit)
+
+	query := `
+		WITH session_sources AS (
+			SELECT
+				session_id,
+				(ARRAY_AGG(` + expression + ` ORDER BY timestamp))[1] AS name,
+				CASE WHEN ` + bouncedSessionCondition + ` THEN 1 ELSE 0 END AS bounced
+			FROM ` + hits + `
+			GROUP BY session_id
+		)
+		SELECT
+			name,
+			COUNT(*) AS sessions,
+			SUM(bounced) * 100.0 / COUNT(*) AS bounce_rate
+		FROM session_sources
+		GROUP BY name
+		ORDER BY sessions DESC
+		LIMIT ?
+	`
+
+	var results []structs.AcquisitionRow
+	if err := database.Reports.Raw(query, params...).Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query %s report: %w", dimension, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,49 @@
+package statistics
+
+import (
+	"statistics/structs"
+)
+
+// Values of the compare parameter
+const (
+	ComparePreviousPeriod = "previous_period" // The window of the same length right before
+	ComparePreviousYear   = "previous_year"   // The same window one year earlier
+)
+
+// ComparisonScope returns the scope of the comparison window selected with
+// compare, false when the request does not compare.
+func (p Params) ComparisonScope() (Scope, bool) {
+	scope := p.Scope()
+	switch p.Compare {
+	case ComparePreviousPeriod:
+		span := p.To.Sub(p.From)
+		scope.From, scope.To = p.From.Add(-span), p.From
+	case ComparePreviousYear:
+		scope.From, scope.To = p.From.AddDate(-1, 0, 0), p.To.AddDate(-1, 0, 0)
+	default:
+		return scope, false
+	}
+	return scope, true
+}
+
+// NewComparison compares the metrics of a response with their values in the
+// comparison window of scope.
+func NewComparison(scope Scope, current, previous map[string]float64) *structs.Comparison {
+	comparison := compareValues(current, previous)
+	comparison.From, comparison.To = &scope.From, &scope.To
+	return comparison
+}
+
+// compareValues compares the metrics of one row, without the window.
+func compareValues(current, previous map[string]float64) *structs.Comparison {
+	comparison := &structs.Comparison{Values: previous, Delta: make(map[string]structs.Delta, len(current))}
+	for name, value := range current {
+		delta := structs.Delta{Absolute: value - previous[name]}
+		if previous[name] != 0 {
+			percent := delta.Absolute / previous[name] * 100
+			delta.Percent = &percent
+		}
+		comparison.Delta[name] = delta
+	}
+	return comparison
+}
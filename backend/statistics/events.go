@@ -0,0 +1,42 @@
+package statistics
+
+import (
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+)
+
+// GetEventCounts returns how often each custom event fired and by how many sessions.
+func GetEventCounts(scope Scope) ([]structs.EventCount, error) {
+	var results []structs.EventCount
+
+	where, params := scope.EventWhere()
+	query := database.Reports.
+		Model(&structs.Event{}).
+		Select("name, COUNT(*) as count, COUNT(DISTINCT session_id) as unique_sessions").
+		Where(where, params...)
+
+	err := query.Group("name").Order("count DESC").Find(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event counts: %w", err)
+	}
+	return results, nil
+}
+
+// GetEventPropertyBreakdown groups the occurrences of an event by the value of a single property.
+func GetEventPropertyBreakdown(scope Scope, event, property string) ([]structs.EventPropertyBreakdown, error) {
+	var results []structs.EventPropertyBreakdown
+
+	where, params := scope.EventWhere()
+	query := database.Reports.
+		Model(&structs.Event{}).
+		Select("COALESCE(properties ->> ?, '(not set)') as value, COUNT(*) as count, COUNT(DISTINCT session_id) as unique_sessions", property).
+		Where(where, params...).
+		Where("name = ?", event)
+
+	err := query.Group("value").Order("count DESC").Find(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event property breakdown: %w", err)
+	}
+	return results, nil
+}
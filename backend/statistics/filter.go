@@ -0,0 +1,164 @@
+package statistics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterFields maps the fields of filter expressions to web_metrics columns.
+// Only these columns can appear in the generated SQL.
+var filterFields = map[string]string{
+	"page":            "page",
+	"country":         "country_code",
+	"city":            "city",
+	"region":          "region",
+	"browser":         "browser",
+	"browser_version": "browser_version",
+	"os":              "os",
+	"os_version":      "os_version",
+	"device":          "device",
+	"referrer":        "referrer_source",
+	"utm_source":      "utm_source",
+	"utm_medium":      "utm_medium",
+	"utm_campaign":    "utm_campaign",
+	"utm_term":        "utm_term",
+	"utm_content":     "utm_content",
+	"method":          "source", // Tracking method: script, batch or pixel
+}
+
+// Filter operators, the first one in a condition separates the field from the value
+var filterOperators = []string{"==", "!=", "=~", "!~"}
+
+// maxFilterConditions keeps generated queries at a reasonable size.
+const maxFilterConditions = 20
+
+// maxFilterPattern is the longest regular expression of =~ and !~ in bytes.
+// PostgreSQL has no protection against costly patterns, the report queries
+// also run under a statement_timeout, see database.Reports.
+const maxFilterPattern = 256
+
+// Condition is one comparison of a filter expression.
+type Condition struct {
+	Field    string
+	Operator string   // ==, !=, =~ or !~
+	Values   []string // Alternatives of == and !=, a single pattern for =~ and !~
+}
+
+// Filter is a parsed filter expression. Every condition must hold for a page
+// view to be counted.
+type Filter []Condition
+
+// ParseFilter parses a filter expression: conditions separated by ";", each a
+// field, an operator and a value, e.g. "country==DE;page=~^/blog/".
+//
+//   - == and != compare with one of the comma-separated values (country==DE,AT)
+//   - =~ and !~ match a POSIX regular expression
+//
+// A ";" inside a value is written as "\;".
+func ParseFilter(expression string) (Filter, error) {
+	var filter Filter
+	for _, part := range splitConditions(expression) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		condition, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, condition)
+	}
+
+	if len(filter) > maxFilterConditions {
+		return nil, fmt.Errorf("at most %d filter conditions are allowed", maxFilterConditions)
+	}
+	return filter, nil
+}
+
+// splitConditions splits at every ";" that is not escaped as "\;".
+func splitConditions(expression string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(expression); i++ {
+		switch {
+		case expression[i] == '\\' && i+1 < len(expression) && expression[i+1] == ';':
+			current.WriteByte(';')
+			i++
+		case expression[i] == ';':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(expression[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+func parseCondition(part string) (Condition, error) {
+	index, operator := -1, ""
+	for _, candidate := range filterOperators {
+		if i := strings.Index(part, candidate); i > 0 && (index == -1 || i < index) {
+			index, operator = i, candidate
+		}
+	}
+	if index == -1 {
+		return Condition{}, fmt.Errorf("missing operator in filter condition %q", part)
+	}
+
+	field := strings.TrimSpace(part[:index])
+	value := part[index+len(operator):]
+	if _, ok := filterFields[field]; !ok {
+		return Condition{}, fmt.Errorf("unknown filter field %q", field)
+	}
+	if value == "" {
+		return Condition{}, fmt.Errorf("missing value in filter condition %q", part)
+	}
+
+	condition := Condition{Field: field, Operator: operator}
+	switch operator {
+	case "==", "!=":
+		for _, v := range strings.Split(value, ",") {
+			condition.Values = append(condition.Values, strings.TrimSpace(v))
+		}
+	default:
+		if len(value) > maxFilterPattern {
+			return Condition{}, fmt.Errorf("regular expression in filter condition %q is longer than %d bytes", field, maxFilterPattern)
+		}
+		// RE2 rejects most patterns PostgreSQL would fail on, so a typo is a 400 and not a 500
+		if _, err := regexp.Compile(value); err != nil {
+			return Condition{}, fmt.Errorf("invalid regular expression in filter condition %q", part)
+		}
+		condition.Values = []string{value}
+	}
+	return condition, nil
+}
+
+// sql returns the filter as a parameterized condition on web_metrics, "" for
+// an empty filter. Field names come from filterFields and values are always
+// passed as parameters.
+func (f Filter) sql() (string, []interface{}) {
+	var conditions []string
+	var params []interface{}
+
+	for _, condition := range f {
+		column := filterFields[condition.Field]
+		switch condition.Operator {
+		case "==":
+			conditions = append(conditions, column+" IN ?")
+			params = append(params, condition.Values)
+		case "!=":
+			// Missing values, e.g. an unknown country, differ from every value
+			conditions = append(conditions, "("+column+" IS NULL OR "+column+" NOT IN ?)")
+			params = append(params, condition.Values)
+		case "=~":
+			conditions = append(conditions, column+" ~ ?")
+			params = append(params, condition.Values[0])
+		case "!~":
+			conditions = append(conditions, "("+column+" IS NULL OR "+column+" !~ ?)")
+			params = append(params, condition.Values[0])
+		}
+	}
+	return strings.Join(conditions, " AND "), params
+}
@@ -0,0 +1,171 @@
+package statistics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       Filter
+		wantErr    bool
+	}{
+		{
+			name:       "empty",
+			expression: "",
+			want:       nil,
+		},
+		{
+			name:       "single value",
+			expression: "country==DE",
+			want:       Filter{{Field: "country", Operator: "==", Values: []string{"DE"}}},
+		},
+		{
+			name:       "alternatives",
+			expression: "country==DE, AT",
+			want:       Filter{{Field: "country", Operator: "==", Values: []string{"DE", "AT"}}},
+		},
+		{
+			name:       "several conditions",
+			expression: "device!=mobile; page=~^/blog/",
+			want: Filter{
+				{Field: "device", Operator: "!=", Values: []string{"mobile"}},
+				{Field: "page", Operator: "=~", Values: []string{"^/blog/"}},
+			},
+		},
+		{
+			name:       "empty conditions are skipped",
+			expression: ";;browser==Firefox;",
+			want:       Filter{{Field: "browser", Operator: "==", Values: []string{"Firefox"}}},
+		},
+		{
+			name:       "escaped separator",
+			expression: `utm_campaign==a\;b`,
+			want:       Filter{{Field: "utm_campaign", Operator: "==", Values: []string{"a;b"}}},
+		},
+		{
+			name:       "first operator wins",
+			expression: "page!~a==b",
+			want:       Filter{{Field: "page", Operator: "!~", Values: []string{"a==b"}}},
+		},
+		{
+			name:       "regular expression at the length limit",
+			expression: "page=~" + strings.Repeat("a", maxFilterPattern),
+			want:       Filter{{Field: "page", Operator: "=~", Values: []string{strings.Repeat("a", maxFilterPattern)}}},
+		},
+		{
+			name:       "regular expression over the length limit",
+			expression: "page=~" + strings.Repeat("a", maxFilterPattern+1),
+			wantErr:    true,
+		},
+		{
+			name:       "long value of ==",
+			expression: "page==" + strings.Repeat("a", maxFilterPattern+1),
+			want:       Filter{{Field: "page", Operator: "==", Values: []string{strings.Repeat("a", maxFilterPattern+1)}}},
+		},
+		{
+			name:       "invalid regular expression",
+			expression: "page=~(",
+			wantErr:    true,
+		},
+		{
+			name:       "unknown field",
+			expression: "session_id==1",
+			wantErr:    true,
+		},
+		{
+			name:       "missing operator",
+			expression: "country",
+			wantErr:    true,
+		},
+		{
+			name:       "missing field",
+			expression: "==DE",
+			wantErr:    true,
+		},
+		{
+			name:       "missing value",
+			expression: "country==",
+			wantErr:    true,
+		},
+		{
+			name:       "too many conditions",
+			expression: strings.Repeat("country==DE;", maxFilterConditions+1),
+			wantErr:    true,
+		},
+		{
+			name:       "as many conditions as allowed",
+			expression: strings.TrimSuffix(strings.Repeat("os==Linux;", maxFilterConditions), ";"),
+			want: func() Filter {
+				filter := make(Filter, maxFilterConditions)
+				for i := range filter {
+					filter[i] = Condition{Field: "os", Operator: "==", Values: []string{"Linux"}}
+				}
+				return filter
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter(%q) = %#v, want %#v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSQL(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     Filter
+		wantSQL    string
+		wantParams []interface{}
+	}{
+		{
+			name:    "empty",
+			filter:  nil,
+			wantSQL: "",
+		},
+		{
+			name:       "equal",
+			filter:     Filter{{Field: "country", Operator: "==", Values: []string{"DE", "AT"}}},
+			wantSQL:    "country_code IN ?",
+			wantParams: []interface{}{[]string{"DE", "AT"}},
+		},
+		{
+			name:       "not equal keeps missing values",
+			filter:     Filter{{Field: "referrer", Operator: "!=", Values: []string{"google"}}},
+			wantSQL:    "(referrer_source IS NULL OR referrer_source NOT IN ?)",
+			wantParams: []interface{}{[]string{"google"}},
+		},
+		{
+			name: "regular expressions",
+			filter: Filter{
+				{Field: "page", Operator: "=~", Values: []string{"^/blog/"}},
+				{Field: "method", Operator: "!~", Values: []string{"pixel"}},
+			},
+			wantSQL:    "page ~ ? AND (source IS NULL OR source !~ ?)",
+			wantParams: []interface{}{"^/blog/", "pixel"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, params := tt.filter.sql()
+			if sql != tt.wantSQL {
+				t.Errorf("sql() = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("sql() params = %#v, want %#v", params, tt.wantParams)
+			}
+		})
+	}
+}
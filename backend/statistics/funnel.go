@@ -0,0 +1,263 @@
+package statistics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"statistics/database"
+	"statistics/sites"
+	"statistics/structs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of funnel steps
+const (
+	FunnelStepPage  = "page"
+	FunnelStepEvent = "event"
+)
+
+// Funnel length limits, a funnel compares at least two steps
+const (
+	minFunnelSteps = 2
+	maxFunnelSteps = 10
+)
+
+// ParseFunnelSteps reads the steps of a funnel in order. A step is a page
+// pattern or an event name, prefixed with its kind: "page:/pricing",
+// "page:/blog/*" or "event:signup". Steps without a prefix are pages.
+func ParseFunnelSteps(values []string) ([]structs.FunnelStep, error) {
+	if len(values) < minFunnelSteps || len(values) > maxFunnelSteps {
+		return nil, fmt.Errorf("a funnel needs between %d and %d steps", minFunnelSteps, maxFunnelSteps)
+	}
+
+	steps := make([]structs.FunnelStep, 0, len(values))
+	for _, value := range values {
+		step := structs.FunnelStep{Kind: FunnelStepPage, Pattern: value}
+		if kind, pattern, found := strings.Cut(value, ":"); found && (kind == FunnelStepPage || kind == FunnelStepEvent) {
+			step = structs.FunnelStep{Kind: kind, Pattern: pattern}
+		}
+		step.Pattern = strings.TrimSpace(step.Pattern)
+		if step.Pattern == "" {
+			return nil, errors.New("funnel steps must not be empty")
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// likePattern translates a step pattern to a LIKE pattern, "*" matches any characters.
+func likePattern(pattern string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(pattern)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// patternRegexp is the Go equivalent of likePattern.
+func patternRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// funnelAction is a page view or event of a session that matches at least one step.
+type funnelAction struct {
+	SessionId string
+	Timestamp time.Time
+	Position  int // Index among all actions of the session, consecutive actions differ by one
+	Kind      string
+	Name      string
+}
+
+// GetFunnel counts the sessions of the scope that went through the steps in
+// order. Loose ordering allows other page views and events between the steps,
+// strict ordering requires every step to directly follow the previous one.
+// A window above zero is the longest time allowed between two steps.
+//
+// Page views and events are split into sessions together: like in SessionHits
+// a gap longer than the session timeout of the site starts a new session, and
+// an identifier has separate sessions on each site, but an event between two
+// page views also keeps them in one session. Funnel sessions can therefore
+// differ from the ones of the other reports. The filter of the scope applies
+// to page views only.
+func GetFunnel(scope Scope, steps []structs.FunnelStep, window time.Duration, strict bool) (structs.Funnel, error) {
+	var sources []string
+	var params []interface{}
+	var stepConditions []string
+	var stepParams []interface{}
+	kinds := map[string]bool{}
+	for _, step := range steps {
+		stepConditions = append(stepConditions, "(kind = ? AND name LIKE ?)")
+		stepParams = append(stepParams, step.Kind, likePattern(step.Pattern))
+		kinds[step.Kind] = true
+	}
+	// Only the kinds used by the steps take part, so for strict ordering e.g.
+	// a click event does not break a funnel of pages
+	if kinds[FunnelStepPage] {
+		where, whereParams := scope.Where()
+		sources = append(sources, `SELECT session_id, site, timestamp, id, 'page' AS kind, page AS name FROM web_metrics WHERE `+where)
+		params = append(params, whereParams...)
+	}
+	if kinds[FunnelStepEvent] {
+		where, whereParams := scope.EventWhere()
+		sources = append(sources, `SELECT session_id, site, timestamp, id, 'event' AS kind, name FROM events WHERE `+where)
+		params = append(params, whereParams...)
+	}
+
+	query := `
+		WITH actions AS (
+			` + strings.Join(sources, " UNION ALL ") + `
+		), gaps AS (
+			SELECT actions.*,
+				CASE WHEN timestamp - LAG(timestamp) OVER (PARTITION BY session_id, site ORDER BY timestamp, kind, id)
+					> COALESCE(sites.session_timeout, ` + strconv.Itoa(sites.DefaultSessionTimeout) + `) * INTERVAL '1 minute'
+				THEN 1 ELSE 0 END AS new_session
+			FROM actions LEFT JOIN sites ON sites.name = actions.site
+		), visits AS (
+			SELECT
+				session_id || '-' || COALESCE(site, '') || '-' || SUM(new_session) OVER (PARTITION BY session_id, site ORDER BY timestamp, kind, id) AS session_id,
+				timestamp, kind, name, id
+			FROM gaps
+		), numbered AS (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp, kind, id) AS position
+			FROM visits
+		)
+		SELECT session_id, timestamp, position, kind, name
+		FROM numbered
+		WHERE ` + strings.Join(stepConditions, " OR ") + `
+		ORDER BY session_id, position
+	`
+	params = append(params, stepParams...)
+
+	rows, err := database.Reports.Raw(query, params...).Rows()
+	if err != nil {
+		return structs.Funnel{}, fmt.Errorf("failed to query funnel: %w", err)
+	}
+	defer rows.Close()
+
+	matchers := make([]*regexp.Regexp, len(steps))
+	for i, step := range steps {
+		matchers[i] = patternRegexp(step.Pattern)
+	}
+
+	counts := make([]int, len(steps))
+	var converted int
+	var timeToConvert time.Duration
+
+	var session []funnelAction
+	evaluate := func() {
+		if len(session) == 0 {
+			return
+		}
+		reached, duration := walkFunnel(session, steps, matchers, window, strict)
+		for i := 0; i < reached; i++ {
+			counts[i]++
+		}
+		if reached == len(steps) {
+			converted++
+			timeToConvert += duration
+		}
+		session = session[:0]
+	}
+
+	for rows.Next() {
+		var action funnelAction
+		if err := rows.Scan(&action.SessionId, &action.Timestamp, &action.Position, &action.Kind, &action.Name); err != nil {
+			return structs.Funnel{}, fmt.Errorf("failed to read funnel: %w", err)
+		}
+		if len(session) > 0 && session[0].SessionId != action.SessionId {
+			evaluate()
+		}
+		session = append(session, action)
+	}
+	if err := rows.Err(); err != nil {
+		return structs.Funnel{}, fmt.Errorf("failed to read funnel: %w", err)
+	}
+	evaluate()
+
+	return funnelResult(steps, counts, converted, timeToConvert), nil
+}
+
+// walkFunnel returns how many steps a session reached and, when it reached
+// all of them, the time from the first to the last step. Every step keeps the
+// latest arrival, so a later start of the funnel can still complete it within
+// the window.
+func walkFunnel(session []funnelAction, steps []structs.FunnelStep, matchers []*regexp.Regexp, window time.Duration, strict bool) (int, time.Duration) {
+	type arrival struct {
+		at       time.Time
+		started  time.Time
+		position int
+		ok       bool
+	}
+	arrivals := make([]arrival, len(steps))
+
+	for _, action := range session {
+		// Backwards, so one action cannot take a session over two steps
+		for i := len(steps) - 1; i >= 0; i-- {
+			if steps[i].Kind != action.Kind || !matchers[i].MatchString(action.Name) {
+				continue
+			}
+			if i == 0 {
+				arrivals[0] = arrival{at: action.Timestamp, started: action.Timestamp, position: action.Position, ok: true}
+				continue
+			}
+			previous := arrivals[i-1]
+			if !previous.ok {
+				continue
+			}
+			if strict && action.Position != previous.position+1 {
+				continue
+			}
+			if window > 0 && action.Timestamp.Sub(previous.at) > window {
+				continue
+			}
+			arrivals[i] = arrival{at: action.Timestamp, started: previous.started, position: action.Position, ok: true}
+		}
+	}
+
+	reached := 0
+	for i := range arrivals {
+		if !arrivals[i].ok {
+			break
+		}
+		reached = i + 1
+	}
+	if reached == len(steps) {
+		last := arrivals[len(steps)-1]
+		return reached, last.at.Sub(last.started)
+	}
+	return reached, 0
+}
+
+func funnelResult(steps []structs.FunnelStep, counts []int, converted int, timeToConvert time.Duration) structs.Funnel {
+	percent := func(part, whole int) float64 {
+		if whole == 0 {
+			return 0
+		}
+		return float64(part) * 100 / float64(whole)
+	}
+
+	funnel := structs.Funnel{Steps: make([]structs.FunnelStepResult, len(steps))}
+	for i, step := range steps {
+		previous := counts[0]
+		if i > 0 {
+			previous = counts[i-1]
+		}
+		funnel.Steps[i] = structs.FunnelStepResult{
+			FunnelStep:         step,
+			Sessions:           counts[i],
+			ConversionRate:     percent(counts[i], counts[0]),
+			StepConversionRate: percent(counts[i], previous),
+			DropOff:            previous - counts[i],
+			DropOffRate:        percent(previous-counts[i], previous),
+		}
+	}
+
+	funnel.ConversionRate = percent(counts[len(steps)-1], counts[0])
+	if converted > 0 {
+		funnel.AverageTimeToConvert = timeToConvert.Seconds() / float64(converted)
+	}
+	return funnel
+}
@@ -0,0 +1,225 @@
+package statistics
+
+import (
+	"reflect"
+	"regexp"
+	"statistics/structs"
+	"testing"
+	"time"
+)
+
+func TestParseFunnelSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []structs.FunnelStep
+		wantErr bool
+	}{
+		{
+			name:   "kinds",
+			values: []string{"page:/pricing", "event:signup"},
+			want:   []structs.FunnelStep{{Kind: "page", Pattern: "/pricing"}, {Kind: "event", Pattern: "signup"}},
+		},
+		{
+			name:   "pages without a prefix",
+			values: []string{"/", " /blog/* "},
+			want:   []structs.FunnelStep{{Kind: "page", Pattern: "/"}, {Kind: "page", Pattern: "/blog/*"}},
+		},
+		{
+			name:   "unknown prefix is part of the page",
+			values: []string{"/a", "click:/b"},
+			want:   []structs.FunnelStep{{Kind: "page", Pattern: "/a"}, {Kind: "page", Pattern: "click:/b"}},
+		},
+		{
+			name:    "empty step",
+			values:  []string{"/a", "event: "},
+			wantErr: true,
+		},
+		{
+			name:    "too few steps",
+			values:  []string{"/a"},
+			wantErr: true,
+		},
+		{
+			name:    "too many steps",
+			values:  []string{"/1", "/2", "/3", "/4", "/5", "/6", "/7", "/8", "/9", "/10", "/11"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFunnelSteps(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFunnelSteps(%q) error = %v, wantErr %v", tt.values, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFunnelSteps(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"/pricing", "/pricing"},
+		{"/blog/*", "/blog/%"},
+		{"100%_off", `100\%\_off`},
+		{`a\b*`, `a\\b%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePattern(tt.pattern); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestWalkFunnel(t *testing.T) {
+	start := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	// action builds the position-th action of a session, minutes after start
+	action := func(position, minutes int, kind, name string) funnelAction {
+		return funnelAction{
+			SessionId: "s",
+			Timestamp: start.Add(time.Duration(minutes) * time.Minute),
+			Position:  position,
+			Kind:      kind,
+			Name:      name,
+		}
+	}
+	pages := []structs.FunnelStep{{Kind: "page", Pattern: "/"}, {Kind: "page", Pattern: "/pricing"}, {Kind: "page", Pattern: "/checkout*"}}
+	signup := []structs.FunnelStep{{Kind: "page", Pattern: "/pricing"}, {Kind: "event", Pattern: "signup"}}
+
+	tests := []struct {
+		name         string
+		steps        []structs.FunnelStep
+		session      []funnelAction
+		window       time.Duration
+		strict       bool
+		wantReached  int
+		wantDuration time.Duration
+	}{
+		{
+			name:         "all steps",
+			steps:        pages,
+			session:      []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing"), action(3, 5, "page", "/checkout/pay")},
+			wantReached:  3,
+			wantDuration: 5 * time.Minute,
+		},
+		{
+			name:        "wrong order",
+			steps:       pages,
+			session:     []funnelAction{action(1, 0, "page", "/pricing"), action(2, 1, "page", "/")},
+			wantReached: 1,
+		},
+		{
+			name:        "no first step",
+			steps:       pages,
+			session:     []funnelAction{action(1, 0, "page", "/pricing"), action(2, 1, "page", "/checkout")},
+			wantReached: 0,
+		},
+		{
+			name:         "loose ordering allows other actions between",
+			steps:        pages,
+			session:      []funnelAction{action(1, 0, "page", "/"), action(3, 1, "page", "/pricing"), action(6, 2, "page", "/checkout")},
+			wantReached:  3,
+			wantDuration: 2 * time.Minute,
+		},
+		{
+			name:        "strict ordering requires consecutive actions",
+			steps:       pages,
+			session:     []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing"), action(4, 2, "page", "/checkout")},
+			strict:      true,
+			wantReached: 2,
+		},
+		{
+			name:         "strict ordering with consecutive actions",
+			steps:        pages,
+			session:      []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing"), action(3, 2, "page", "/checkout")},
+			strict:       true,
+			wantReached:  3,
+			wantDuration: 2 * time.Minute,
+		},
+		{
+			name:        "window exceeded",
+			steps:       pages,
+			session:     []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing"), action(3, 20, "page", "/checkout")},
+			window:      10 * time.Minute,
+			wantReached: 2,
+		},
+		{
+			name:         "later start completes within the window",
+			steps:        pages,
+			session:      []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing"), action(3, 30, "page", "/"), action(4, 31, "page", "/pricing"), action(5, 35, "page", "/checkout")},
+			window:       10 * time.Minute,
+			wantReached:  3,
+			wantDuration: 5 * time.Minute,
+		},
+		{
+			name:        "one action takes a single step",
+			steps:       []structs.FunnelStep{{Kind: "page", Pattern: "/*"}, {Kind: "page", Pattern: "/*"}},
+			session:     []funnelAction{action(1, 0, "page", "/")},
+			wantReached: 1,
+		},
+		{
+			name:         "page then event",
+			steps:        signup,
+			session:      []funnelAction{action(1, 0, "page", "/pricing"), action(2, 3, "event", "signup")},
+			wantReached:  2,
+			wantDuration: 3 * time.Minute,
+		},
+		{
+			name:        "kind must match",
+			steps:       signup,
+			session:     []funnelAction{action(1, 0, "page", "/pricing"), action(2, 3, "page", "signup")},
+			wantReached: 1,
+		},
+		{
+			name:        "patterns match the whole name",
+			steps:       pages,
+			session:     []funnelAction{action(1, 0, "page", "/"), action(2, 1, "page", "/pricing/plans")},
+			wantReached: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchers := make([]*regexp.Regexp, len(tt.steps))
+			for i, step := range tt.steps {
+				matchers[i] = patternRegexp(step.Pattern)
+			}
+			reached, duration := walkFunnel(tt.session, tt.steps, matchers, tt.window, tt.strict)
+			if reached != tt.wantReached || duration != tt.wantDuration {
+				t.Errorf("walkFunnel() = %d, %s, want %d, %s", reached, duration, tt.wantReached, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestFunnelResult(t *testing.T) {
+	steps := []structs.FunnelStep{{Kind: "page", Pattern: "/"}, {Kind: "page", Pattern: "/pricing"}, {Kind: "event", Pattern: "signup"}}
+	funnel := funnelResult(steps, []int{200, 50, 10}, 10, 100*time.Second)
+
+	if funnel.ConversionRate != 5 {
+		t.Errorf("ConversionRate = %v, want 5", funnel.ConversionRate)
+	}
+	if funnel.AverageTimeToConvert != 10 {
+		t.Errorf("AverageTimeToConvert = %v, want 10", funnel.AverageTimeToConvert)
+	}
+	second := funnel.Steps[1]
+	if second.Sessions != 50 || second.ConversionRate != 25 || second.StepConversionRate != 25 || second.DropOff != 150 || second.DropOffRate != 75 {
+		t.Errorf("second step = %+v", second)
+	}
+	third := funnel.Steps[2]
+	if third.ConversionRate != 5 || third.StepConversionRate != 20 || third.DropOff != 40 {
+		t.Errorf("third step = %+v", third)
+	}
+
+	empty := funnelResult(steps, []int{0, 0, 0}, 0, 0)
+	if empty.ConversionRate != 0 || empty.Steps[1].StepConversionRate != 0 || empty.AverageTimeToConvert != 0 {
+		t.Errorf("empty funnel = %+v", empty)
+	}
+}
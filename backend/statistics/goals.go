@@ -0,0 +1,135 @@
+package statistics
+
+import (
+	"fmt"
+	"statistics/database"
+	"statistics/goals"
+	"statistics/sites"
+	"statistics/structs"
+	"strconv"
+)
+
+// goalSessions returns a WITH clause defining goal_sessions: a row per
+// session with a page view in the range, the sessions GetUsers counts, with
+// its landing page, source and country and whether it reached the goal there.
+func goalSessions(scope Scope, goal structs.Goal) (string, []interface{}) {
+	converted, params := "FALSE", []interface{}{}
+	switch goal.Kind {
+	case goals.KindPage:
+		converted = "BOOL_OR(page LIKE ?)"
+		params = append(params, likePattern(goal.Pattern))
+	case goals.KindDuration:
+		converted = "MAX(timestamp) - MIN(timestamp) >= (?::int) * INTERVAL '1 minute'"
+		params = append(params, goal.Duration)
+	}
+
+	hits, hitParams := scope.SessionHits()
+	params = append(params, hitParams...)
+	query := `
+		WITH sessions AS (
+			SELECT
+				session_id,
+				MIN(visitor_id) AS visitor_id,
+				MIN(site) AS site,
+				MIN(timestamp) AS started,
+				MAX(timestamp) AS ended,
+				(ARRAY_AGG(page ORDER BY timestamp))[1] AS page,
+				(ARRAY_AGG(` + acquisitionDimensions["source"] + ` ORDER BY timestamp))[1] AS source,
+				(ARRAY_AGG(COALESCE(country_code, 'XX') ORDER BY timestamp))[1] AS country,
+				` + converted + ` AS converted
+			FROM ` + hits + `
+			GROUP BY session_id
+		)`
+
+	if goal.Kind != goals.KindEvent {
+		return query + `, goal_sessions AS (SELECT session_id, page, source, country, converted FROM sessions)`, params
+	}
+
+	// Events keep the identifier of the client, an event belongs to the session
+	// it fired in, or within the session timeout after its last page view
+	where, eventParams := scope.EventWhere()
+	query += `, goal_sessions AS (
+			SELECT
+				sessions.session_id, page, source, country,
+				EXISTS (
+					SELECT 1 FROM events
+					WHERE ` + where + `
+						AND events.session_id = sessions.visitor_id
+						AND events.site = sessions.site
+						AND events.name LIKE ?
+						AND events.timestamp BETWEEN sessions.started
+							AND sessions.ended + COALESCE(sites.session_timeout, ` + strconv.Itoa(sites.DefaultSessionTimeout) + `) * INTERVAL '1 minute'
+				) AS converted
+			FROM sessions LEFT JOIN sites ON sites.name = sessions.site
+		)`
+	params = append(params, eventParams...)
+	params = append(params, likePattern(goal.Pattern))
+	return query, params
+}
+
+// GetGoalTotals counts the sessions of the scope and those that reached the
+// goal, like GetGoalConversions does.
+func GetGoalTotals(scope Scope, goal structs.Goal) (int, int, error) {
+	var totals struct {
+		Sessions    int
+		Conversions int
+	}
+
+	with, params := goalSessions(scope, goal)
+	query := with + `
+		SELECT COUNT(*) AS sessions, COUNT(*) FILTER (WHERE converted) AS conversions
+		FROM goal_sessions
+	`
+	if err := database.Reports.Raw(query, params...).Scan(&totals).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to count goal conversions: %w", err)
+	}
+	return totals.Sessions, totals.Conversions, nil
+}
+
+// GetGoalConversions reports the conversions of a goal, in total and by
+// landing page, source and country. Breakdowns list the limit groups with the
+// most conversions. Sources follow GetAcquisition.
+func GetGoalConversions(scope Scope, goal structs.Goal, limit int) (structs.GoalConversions, error) {
+	result := structs.GoalConversions{Goal: goal}
+
+	var err error
+	result.Sessions, result.Conversions, err = GetGoalTotals(scope, goal)
+	if err != nil {
+		return result, err
+	}
+	if result.Sessions > 0 {
+		result.ConversionRate = float64(result.Conversions) * 100 / float64(result.Sessions)
+	}
+
+	with, params := goalSessions(scope, goal)
+	breakdown := func(column string) ([]structs.GoalBreakdownRow, error) {
+		query := with + `
+			SELECT
+				` + column + ` AS name,
+				COUNT(*) AS sessions,
+				COUNT(*) FILTER (WHERE converted) AS conversions,
+				COUNT(*) FILTER (WHERE converted) * 100.0 / COUNT(*) AS conversion_rate
+			FROM goal_sessions
+			GROUP BY 1
+			HAVING COUNT(*) FILTER (WHERE converted) > 0
+			ORDER BY conversions DESC, sessions DESC
+			LIMIT ?
+		`
+		rows := []structs.GoalBreakdownRow{}
+		if err := database.Reports.Raw(query, append(params, limit)...).Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to query goal conversions by %s: %w", column, err)
+		}
+		return rows, nil
+	}
+
+	if result.ByPage, err = breakdown("page"); err != nil {
+		return result, err
+	}
+	if result.BySource, err = breakdown("source"); err != nil {
+		return result, err
+	}
+	if result.ByCountry, err = breakdown("country"); err != nil {
+		return result, err
+	}
+	return result, nil
+}
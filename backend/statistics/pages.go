@@ -0,0 +1,90 @@
+package statistics
+
+import (
+	"fmt"
+	"statistics/database"
+	"statistics/structs"
+)
+
+// GetEntryPages groups sessions by their first page and reports the sessions
+// and bounce rate of each. Bounces use the same definition as GetBounceRate.
+func GetEntryPages(scope Scope, limit int) ([]structs.EntryPageRow, error) {
+	var results []structs.EntryPageRow
+
+	if where, params, ok := scope.SessionWhere(); ok {
+		query := `
+			SELECT
+				entry_page AS page,
+				COUNT(*) AS sessions,
+				COUNT(*) FILTER (WHERE bounce) * 100.0 / COUNT(*) AS bounce_rate
+			FROM sessions
+			WHERE ` + where + `
+			GROUP BY entry_page
+			ORDER BY sessions DESC
+			LIMIT ?
+		`
+		if err := database.Reports.Raw(query, append(params, limit)...).Scan(&results).Error; err != nil {
+			return nil, fmt.Errorf("failed to query entry pages: %w", err)
+		}
+		return results, nil
+	}
+
+	hits, params := scope.SessionHits()
+	params = append(params, limit)
+
+	query := `
+		WITH entries AS (
+			SELECT
+				session_id,
+				(ARRAY_AGG(page ORDER BY timestamp, id))[1] AS page,
+				CASE WHEN ` + bouncedSessionCondition + ` THEN 1 ELSE 0 END AS bounced
+			FROM ` + hits + `
+			GROUP BY session_id
+		)
+		SELECT
+			page,
+			COUNT(*) AS sessions,
+			SUM(bounced) * 100.0 / COUNT(*) AS bounce_rate
+		FROM entries
+		GROUP BY page
+		ORDER BY sessions DESC
+		LIMIT ?
+	`
+
+	if err := database.Reports.Raw(query, params...).Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query entry pages: %w", err)
+	}
+	return results, nil
+}
+
+// GetExitPages groups sessions by their last page and reports the exits and
+// the exit rate: the share of all views of the page that ended a session.
+func GetExitPages(scope Scope, limit int) ([]structs.ExitPageRow, error) {
+	hits, params := scope.SessionHits()
+	params = append(params, limit)
+
+	query := `
+		WITH views AS (
+			SELECT
+				page,
+				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp DESC, id DESC) = 1 AS is_exit
+			FROM ` + hits + `
+		)
+		SELECT
+			page,
+			COUNT(*) FILTER (WHERE is_exit) AS exits,
+			COUNT(*) AS page_views,
+			COUNT(*) FILTER (WHERE is_exit) * 100.0 / COUNT(*) AS exit_rate
+		FROM views
+		GROUP BY page
+		HAVING COUNT(*) FILTER (WHERE is_exit) > 0
+		ORDER BY exits DESC
+		LIMIT ?
+	`
+
+	var results []structs.ExitPageRow
+	if err := database.Reports.Raw(query, params...).Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query exit pages: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,189 @@
+package statistics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"statistics/access"
+	"statistics/structs"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Params is the typed model of the query parameters shared by the read
+// endpoints, see ParseParams.
+type Params struct {
+	From     time.Time
+	To       time.Time
+	Site     string // Empty for every site the caller may see
+	Timezone string
+	Location *time.Location
+	Filter   Filter
+	Compare  string // ComparePreviousPeriod, ComparePreviousYear or empty
+
+	sites []string
+}
+
+// Scope returns the statistics scope the parameters select.
+func (p Params) Scope() Scope {
+	return Scope{From: p.From, To: p.To, Site: p.Site, Timezone: p.Timezone, Filter: p.Filter, Sites: p.sites}
+}
+
+const dateLayout = "2006-01-02"
+
+var relativeRangePattern = regexp.MustCompile(`^last_(\d+)(m|h|d|w)$`)
+
+var relativeRangeUnits = map[string]time.Duration{
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// maxRelativeRange bounds the relative ranges, n * unit overflows
+// time.Duration from about 290 years.
+const maxRelativeRange = 10 * 365 * 24 * time.Hour
+
+// ParseParams reads the site, timezone and time range of a request:
+//
+//   - site: the site, "page" is accepted as an alias for the older routes
+//   - tz: IANA timezone, defaults to the timezone of the site, see RequestTimezone
+//   - from, to: a date (YYYY-MM-DD, local midnight in tz) or an RFC3339 timestamp
+//   - range: instead of from/to, last_<n><m|h|d|w> (e.g. last_7d), today or yesterday
+//   - filter: a filter expression, see ParseFilter
+//   - compare: previous_period or previous_year, see ComparisonScope
+//
+// Without a range the period ends at to, or now, and starts at from, or
+// defaultSpan before the end. It writes the error response itself and returns
+// false when the input is invalid.
+func ParseParams(c *gin.Context, defaultSpan time.Duration) (Params, bool) {
+	p := Params{Site: access.SiteParam(c), sites: access.Sites(c)}
+
+	var ok bool
+	p.Timezone, p.Location, ok = RequestTimezone(c, p.Site)
+	if !ok {
+		return p, false
+	}
+
+	filter, err := ParseFilter(c.Query("filter"))
+	if err != nil {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "filter", err.Error())
+		return p, false
+	}
+	p.Filter = filter
+
+	switch p.Compare = c.Query("compare"); p.Compare {
+	case "", ComparePreviousPeriod, ComparePreviousYear:
+	default:
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "compare", "Invalid compare, use previous_period or previous_year")
+		return p, false
+	}
+
+	now := time.Now().In(p.Location)
+	fromStr, toStr := c.Query("from"), c.Query("to")
+
+	if rangeStr := c.Query("range"); rangeStr != "" {
+		if fromStr != "" || toStr != "" {
+			AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "range", "range cannot be combined with from or to")
+			return p, false
+		}
+		from, to, err := relativeRange(rangeStr, now)
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "range", err.Error())
+			return p, false
+		}
+		p.From, p.To = from, to
+		return p, true
+	}
+
+	p.To = now
+	if toStr != "" {
+		t, err := parseTime(toStr, p.Location)
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "to", "Invalid end date format, use YYYY-MM-DD or RFC3339")
+			return p, false
+		}
+		p.To = t
+	}
+
+	p.From = p.To.Add(-defaultSpan)
+	if fromStr != "" {
+		t, err := parseTime(fromStr, p.Location)
+		if err != nil {
+			AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "from", "Invalid start date format, use YYYY-MM-DD or RFC3339")
+			return p, false
+		}
+		p.From = t
+	}
+
+	if p.From.After(p.To) {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "from", "from must not be after to")
+		return p, false
+	}
+	return p, true
+}
+
+// parseTime reads a date as midnight in location, or an RFC3339 timestamp.
+func parseTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(dateLayout, value, location); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// relativeRange resolves a range parameter relative to now.
+func relativeRange(value string, now time.Time) (time.Time, time.Time, error) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch value {
+	case "today":
+		return midnight, now, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, nil
+	}
+
+	match := relativeRangePattern.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, time.Time{}, errors.New("Invalid range, use last_<n><m|h|d|w>, today or yesterday")
+	}
+	unit := relativeRangeUnits[match[2]]
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 || int64(n) > int64(maxRelativeRange/unit) {
+		return time.Time{}, time.Time{}, errors.New("Invalid range length, the range can be at most 10 years")
+	}
+	return now.Add(-time.Duration(n) * unit), now, nil
+}
+
+// IntParam reads an optional integer query parameter within [min, max]. It
+// writes the error response itself and returns false when the input is invalid.
+func IntParam(c *gin.Context, name string, defaultValue, min, max int) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return defaultValue, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, name,
+			fmt.Sprintf("%s must be an integer between %d and %d", name, min, max))
+		return 0, false
+	}
+	return n, true
+}
+
+// RequiredParam reads a query parameter that must not be empty. It writes the
+// error response itself and returns false when the parameter is missing.
+func RequiredParam(c *gin.Context, name string) (string, bool) {
+	value := c.Query(name)
+	if value == "" {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeMissingParameter, name, name+" is required")
+		return "", false
+	}
+	return value, true
+}
+
+// AbortWithError answers with the JSON error envelope.
+func AbortWithError(c *gin.Context, status int, code, parameter, message string) {
+	c.AbortWithStatusJSON(status, structs.APIError{Error: message, Code: code, Parameter: parameter})
+}
@@ -0,0 +1,219 @@
+package statistics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelativeRange(t *testing.T) {
+	budapest, err := time.LoadLocation("Europe/Budapest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 15, 13, 30, 0, 0, budapest)
+	// The day after the switch to summer time, the previous day was 23 hours long
+	afterSwitch := time.Date(2024, 4, 1, 12, 0, 0, 0, budapest)
+
+	tests := []struct {
+		name     string
+		value    string
+		now      time.Time
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "today",
+			value:    "today",
+			now:      now,
+			wantFrom: time.Date(2024, 5, 15, 0, 0, 0, 0, budapest),
+			wantTo:   now,
+		},
+		{
+			name:     "yesterday",
+			value:    "yesterday",
+			now:      now,
+			wantFrom: time.Date(2024, 5, 14, 0, 0, 0, 0, budapest),
+			wantTo:   time.Date(2024, 5, 15, 0, 0, 0, 0, budapest),
+		},
+		{
+			name:     "yesterday across the switch to summer time",
+			value:    "yesterday",
+			now:      afterSwitch,
+			wantFrom: time.Date(2024, 3, 31, 0, 0, 0, 0, budapest),
+			wantTo:   time.Date(2024, 4, 1, 0, 0, 0, 0, budapest),
+		},
+		{
+			name:     "today in UTC",
+			value:    "today",
+			now:      now.UTC(),
+			wantFrom: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+			wantTo:   now.UTC(),
+		},
+		{
+			name:     "minutes",
+			value:    "last_30m",
+			now:      now,
+			wantFrom: now.Add(-30 * time.Minute),
+			wantTo:   now,
+		},
+		{
+			name:     "days are 24 hours",
+			value:    "last_1d",
+			now:      afterSwitch,
+			wantFrom: afterSwitch.Add(-24 * time.Hour),
+			wantTo:   afterSwitch,
+		},
+		{
+			name:     "weeks",
+			value:    "last_2w",
+			now:      now,
+			wantFrom: now.Add(-14 * 24 * time.Hour),
+			wantTo:   now,
+		},
+		{
+			name:     "ten years",
+			value:    "last_3650d",
+			now:      now,
+			wantFrom: now.Add(-maxRelativeRange),
+			wantTo:   now,
+		},
+		{
+			name:    "longer than ten years",
+			value:   "last_3651d",
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "overflowing duration",
+			value:   "last_2562048h",
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "overflowing integer",
+			value:   "last_99999999999999999999w",
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			value:   "last_0d",
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "unknown unit",
+			value:   "last_7y",
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			value:   "last_-7d",
+			now:     now,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := relativeRange(tt.value, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("relativeRange(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("relativeRange(%q) = %s, %s, want %s, %s", tt.value, from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	budapest, err := time.LoadLocation("Europe/Budapest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		location *time.Location
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "date is midnight in the location",
+			value:    "2024-05-15",
+			location: budapest,
+			want:     time.Date(2024, 5, 14, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date in winter time",
+			value:    "2024-01-15",
+			location: budapest,
+			want:     time.Date(2024, 1, 14, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date west of UTC",
+			value:    "2024-11-03",
+			location: newYork,
+			want:     time.Date(2024, 11, 3, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "date in UTC",
+			value:    "2024-05-15",
+			location: time.UTC,
+			want:     time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timestamp keeps its offset",
+			value:    "2024-05-15T10:00:00+02:00",
+			location: newYork,
+			want:     time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "UTC timestamp",
+			value:    "2024-05-15T10:00:00Z",
+			location: budapest,
+			want:     time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timestamp without offset",
+			value:    "2024-05-15T10:00:00",
+			location: budapest,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid date",
+			value:    "2024-02-30",
+			location: budapest,
+			wantErr:  true,
+		},
+		{
+			name:     "empty",
+			value:    "",
+			location: budapest,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.value, tt.location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseTime(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package statistics
+
+import (
+	"statistics/database"
+	"time"
+)
+
+// sessionRowColumns select a session as a row of a rollup, see Rollup.
+const sessionRowColumns = `started_at AS bucket, site, entry_page, country_code,
+	1 AS sessions, page_count AS page_views, CASE WHEN bounce THEN 1 ELSE 0 END AS bounces`
+
+// SessionRows returns the sessions of the scope in the columns of Rollup, a
+// row per session with its start as bucket, for the ranges no rollup fits.
+// Reports read them like a rollup, so they count the same whichever they
+// read: a session and all of its page views belong to the bucket it started
+// in. Without the sessions table, see SessionWhere, the hits of the scope
+// are sessionized.
+func (s Scope) SessionRows() (string, []interface{}) {
+	if where, params, ok := s.SessionWhere(); ok {
+		return "(SELECT " + sessionRowColumns + " FROM sessions WHERE " + where + ") AS rollup", params
+	}
+
+	hits, params := s.SessionHits()
+	return `(
+		SELECT MIN(timestamp) AS bucket, MIN(site) AS site,
+			(ARRAY_AGG(page ORDER BY timestamp, id))[1] AS entry_page,
+			(ARRAY_AGG(country_code ORDER BY timestamp, id))[1] AS country_code,
+			1 AS sessions, COUNT(*) AS page_views, CASE WHEN COUNT(*) = 1 THEN 1 ELSE 0 END AS bounces
+		FROM ` + hits + `
+		GROUP BY session_id
+	) AS rollup`, params
+}
+
+// Rollup returns the sessions of the scope as a subquery aliased rollup with
+// the columns bucket, site, entry_page, country_code, sessions, page_views and
+// bounces, for the reports over long ranges. The buckets of the rollup that
+// lie within the range are read from it, the sessions at the edges of the
+// range are a row each with their start as bucket, like in SessionRows. The
+// page of a rollup row is the entry page of its sessions, page views of
+// single pages are counted from web_metrics. Like SessionWhere, ok is false
+// when the reports have to read web_metrics instead.
+func (s Scope) Rollup(rollup database.Rollup) (string, []interface{}, bool) {
+	where, params, ok := s.SessionWhere()
+	if !ok || database.RollupStorage() == "" {
+		return "", nil, false
+	}
+
+	first := s.From.Truncate(rollup.Width)
+	if first.Before(s.From) {
+		first = first.Add(rollup.Width)
+	}
+	last := s.To.Truncate(rollup.Width)
+	edges := `
+		SELECT ` + sessionRowColumns + `
+		FROM sessions
+		WHERE ` + where
+	if !first.Before(last) {
+		return "(" + edges + ") AS rollup", params, true
+	}
+
+	buckets := "bucket >= ? AND bucket < ?"
+	bucketParams := []interface{}{first, last}
+	if condition, siteParams := s.siteCondition("site"); condition != "" {
+		buckets += " AND " + condition
+		bucketParams = append(bucketParams, siteParams...)
+	}
+	params = append(append(params, first, last), bucketParams...)
+	return `(` + edges + ` AND (started_at < ? OR started_at >= ?)
+		UNION ALL
+		SELECT bucket, site, entry_page, country_code, sessions, page_views, bounces
+		FROM ` + rollup.Table + `
+		WHERE ` + buckets + `
+	) AS rollup`, params, true
+}
+
+// rollupFor returns the widest rollup whose buckets fit into the buckets of a
+// report over the scope: buckets of step starting at start, in location. ok
+// is false when none fits, e.g. for half-hour timezone offsets.
+func (s Scope) rollupFor(start time.Time, step time.Duration, location *time.Location) (database.Rollup, bool) {
+	for _, rollup := range database.Rollups {
+		if step%rollup.Width != 0 || !start.Truncate(rollup.Width).Equal(start) {
+			continue
+		}
+		if location != nil && (!alignedOffset(s.From.In(location), rollup.Width) || !alignedOffset(s.To.In(location), rollup.Width)) {
+			continue
+		}
+		return rollup, true
+	}
+	return database.Rollup{}, false
+}
+
+// alignedOffset reports whether the UTC offset of t is a multiple of width,
+// so local buckets of width start where UTC ones do.
+func alignedOffset(t time.Time, width time.Duration) bool {
+	_, offset := t.Zone()
+	return (time.Duration(offset)*time.Second)%width == 0
+}
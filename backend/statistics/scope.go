@@ -0,0 +1,163 @@
+package statistics
+
+import (
+	"math"
+	"statistics/database"
+	"statistics/sessions"
+	"statistics/sites"
+	"strconv"
+	"time"
+)
+
+// Scope selects the hits a statistics query runs over.
+type Scope struct {
+	From time.Time
+	To   time.Time
+	Site string // A single site, empty for every site the caller may see
+
+	// Timezone overrides the timezone days and hours are bucketed in, see timezone.
+	Timezone string
+
+	// Filter restricts the page views counted, it does not apply to events.
+	Filter Filter
+
+	// Sites restricts queries for "all sites" to the sites visible to the
+	// caller. nil means no restriction, an empty slice matches nothing.
+	Sites []string
+}
+
+// siteCondition returns the site part of the WHERE clause, "" when every site matches.
+func (s Scope) siteCondition(column string) (string, []interface{}) {
+	if s.Site != "" {
+		return column + " = ?", []interface{}{s.Site}
+	}
+	if s.Sites != nil {
+		if len(s.Sites) == 0 {
+			return "FALSE", nil
+		}
+		return column + " IN ?", []interface{}{s.Sites}
+	}
+	return "", nil
+}
+
+// Where returns the conditions on web_metrics for the scope, bot traffic
+// excluded and the filter applied.
+func (s Scope) Where() (string, []interface{}) {
+	where, params := s.whereFor("timestamp", "site", true)
+	if condition, filterParams := s.Filter.sql(); condition != "" {
+		where += " AND " + condition
+		params = append(params, filterParams...)
+	}
+	return where, params
+}
+
+// EventWhere returns the conditions on the events table for the scope.
+func (s Scope) EventWhere() (string, []interface{}) {
+	return s.whereFor("timestamp", "site", false)
+}
+
+func (s Scope) whereFor(timestampColumn, siteColumn string, excludeBots bool) (string, []interface{}) {
+	where := timestampColumn + " >= ? AND " + timestampColumn + " <= ?"
+	params := []interface{}{s.From, s.To}
+
+	if excludeBots {
+		where += " AND is_bot = false"
+	}
+	if condition, siteParams := s.siteCondition(siteColumn); condition != "" {
+		where += " AND " + condition
+		params = append(params, siteParams...)
+	}
+	return where, params
+}
+
+// SessionWhere returns the conditions on the sessions table for the scope:
+// the sessions that started within the range. ok is false when the reports
+// have to sessionize web_metrics instead: the filter applies to single page
+// views, and the table is not usable before the sessions job caught up.
+func (s Scope) SessionWhere() (where string, params []interface{}, ok bool) {
+	if len(s.Filter) > 0 || !sessions.Ready() {
+		return "", nil, false
+	}
+	where, params = s.whereFor("started_at", "site", false)
+	return where, params, true
+}
+
+// ActiveSessionWhere returns the conditions on the sessions table for the
+// sessions with a page view within the range, the ones SessionHits counts.
+// A session overlapping the range could skip it with a gap between its page
+// views, not when the range is at least the session timeout long: step is the
+// shortest range the caller counts over. ok is false when step is shorter than
+// the session timeout of a site of the scope, or SessionWhere is not ok.
+func (s Scope) ActiveSessionWhere(step time.Duration) (where string, params []interface{}, ok bool) {
+	if _, _, ok := s.SessionWhere(); !ok || step < s.longestSessionTimeout() {
+		return "", nil, false
+	}
+	where, params = "started_at <= ? AND ended_at >= ?", []interface{}{s.To, s.From}
+	if condition, siteParams := s.siteCondition("site"); condition != "" {
+		where += " AND " + condition
+		params = append(params, siteParams...)
+	}
+	return where, params, true
+}
+
+// longestSessionTimeout returns the longest session timeout of the sites of
+// the scope.
+func (s Scope) longestSessionTimeout() time.Duration {
+	if s.Site != "" {
+		return sites.SessionTimeout(s.Site)
+	}
+	query := "SELECT GREATEST(COALESCE(MAX(session_timeout), 0), ?) FROM sites"
+	params := []interface{}{sites.DefaultSessionTimeout}
+	if condition, siteParams := s.siteCondition("name"); condition != "" {
+		query += " WHERE " + condition
+		params = append(params, siteParams...)
+	}
+	var minutes int
+	if err := database.Reports.Raw(query, params...).Scan(&minutes).Error; err != nil {
+		// Unknown, the hits are counted instead
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// timezone returns the IANA timezone of day, week and hour buckets: the
+// override of the scope, else the setting of its site, else UTC.
+func (s Scope) timezone() string {
+	if s.Timezone != "" {
+		return s.Timezone
+	}
+	if s.Site != "" {
+		return sites.Timezone(s.Site)
+	}
+	return sites.DefaultTimezone
+}
+
+// hitColumns are the web_metrics columns SessionHits passes through, session_id aside.
+const hitColumns = `id, timestamp, page, site, ip, country_code, country_name, city, region, latitude, longitude,
+	referrer, referrer_source, utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+	browser, browser_version, os, os_version, device, source, is_bot`
+
+// SessionHits returns the hits of the scope as a subquery aliased web_metrics,
+// for queries that count sessions. A gap longer than the session timeout of
+// the site starts a new session, so session_id identifies a single visit even
+// when the client keeps its identifier longer, e.g. in cookieless mode. Like
+// in the sessions table, an identifier used on several sites has separate
+// sessions on each. visitor_id keeps the identifier of the client, the session_id of its events.
+func (s Scope) SessionHits() (string, []interface{}) {
+	where, params := s.Where()
+	return `(
+		SELECT ` + hitColumns + `, session_id AS visitor_id,
+			session_id || '-' || COALESCE(site, '') || '-' || SUM(new_session) OVER (PARTITION BY session_id, site ORDER BY timestamp, id) AS session_id
+		FROM (
+			SELECT web_metrics.*,
+				CASE WHEN timestamp - LAG(timestamp) OVER (PARTITION BY session_id, site ORDER BY timestamp, id)
+					> COALESCE(session_timeout, ` + strconv.Itoa(sites.DefaultSessionTimeout) + `) * INTERVAL '1 minute'
+				THEN 1 ELSE 0 END AS new_session
+			FROM (
+				SELECT web_metrics.*, sites.session_timeout
+				FROM web_metrics LEFT JOIN sites ON sites.name = web_metrics.site
+			) AS web_metrics
+			WHERE ` + where + `
+		) AS gaps
+	) AS web_metrics`, params
+}
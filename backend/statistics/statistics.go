@@ -3,99 +3,79 @@ package statistics
 import (
 	"fmt"
 	"net/http"
+	"statistics/access"
 	"statistics/database"
 	"statistics/structs"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetUsers(t1 time.Time, t2 time.Time, site string) int {
+// GetUsers counts the sessions with a page view in the range of the scope.
+func GetUsers(scope Scope) int {
 	var results int
 
-	if site == "" {
-		query := `SELECT COUNT (*) from (SELECT session_id FROM "web_metrics" WHERE "timestamp" >= ? AND "timestamp" <= ? GROUP BY session_id) as lamdba;`
-		database.Session.Raw(query, t1, t2).Scan(&results)
-	}
-	if site != "" {
-		query := `SELECT COUNT (*) from (SELECT session_id FROM "web_metrics" WHERE "timestamp" >= ? AND "timestamp" <= ? AND site = ? GROUP BY session_id) as lamdba;`
-		database.Session.Raw(query, t1, t2, site).Scan(&results)
+	if where, params, ok := scope.ActiveSessionWhere(scope.To.Sub(scope.From)); ok {
+		database.Reports.Raw(`SELECT COUNT(*) FROM sessions WHERE `+where, params...).Scan(&results)
+		return results
 	}
 
+	hits, params := scope.SessionHits()
+	query := `SELECT COUNT (*) from (SELECT session_id FROM ` + hits + ` GROUP BY session_id) as lamdba;`
+	database.Reports.Raw(query, params...).Scan(&results)
+
 	return results
 }
 
-func GetLocations(t1 time.Time, t2 time.Time, site string) []structs.LocationQueryResult {
+func GetLocations(scope Scope) []structs.LocationQueryResult {
 	var results []structs.LocationQueryResult
-	if site == "" {
-		query := `SELECT city, latitude, longitude, COUNT(DISTINCT session_id) as user_count FROM "web_metrics" WHERE "timestamp" >= ? AND "timestamp" <= ? AND city != '' GROUP BY city, latitude, longitude`
-		database.Session.Raw(query, t1, t2).Scan(&results)
-	} else {
-		query := `SELECT city, latitude, longitude, COUNT(DISTINCT session_id) as user_count FROM "web_metrics" WHERE "timestamp" >= ? AND "timestamp" <= ? AND site = ? AND city != '' GROUP BY city, latitude, longitude`
-		database.Session.Raw(query, t1, t2, site).Scan(&results)
-	}
+
+	hits, params := scope.SessionHits()
+	query := `SELECT city, latitude, longitude, COUNT(DISTINCT session_id) as user_count FROM ` + hits + ` WHERE city != '' GROUP BY city, latitude, longitude`
+	database.Reports.Raw(query, params...).Scan(&results)
+
 	return results
 }
 
-func ActiveUsers(page string) int64 {
+// ActiveUsers counts the sessions of the last five minutes. The time range of the scope is ignored.
+func ActiveUsers(scope Scope) int64 {
 	now := time.Now()
-	fiveMinutesAgo := now.Add(-5 * time.Minute)
+	scope.From = now.Add(-5 * time.Minute)
+	scope.To = now
 
 	var count int64
 
-	if page == "" {
-		if err := database.Session.
-			Model(&structs.WebMetric{}).
-			Where("timestamp >= ? AND timestamp <= ?", fiveMinutesAgo, now).
-			Distinct("session_id").
-			Count(&count).Error; err != nil {
-			return 0
-		}
-	} else {
-		if err := database.Session.
-			Model(&structs.WebMetric{}).
-			Where("timestamp >= ? AND timestamp <= ? AND site = ?", fiveMinutesAgo, now, page).
-			Distinct("session_id").
-			Count(&count).Error; err != nil {
-			return 0
-		}
-
+	where, params := scope.Where()
+	if err := database.Reports.
+		Model(&structs.WebMetric{}).
+		Where(where, params...).
+		Distinct("session_id").
+		Count(&count).Error; err != nil {
+		return 0
 	}
 	return count
 }
 
-func TimeOnSite(page string, start time.Time, end time.Time) float64 {
+// TimeOnSite is the average minutes of a session, counting the gaps of at
+// most 5 minutes between its page views.
+func TimeOnSite(scope Scope) float64 {
 	var result structs.AvgTimeResponse // Using structs.AvgTimeResponse here
-	if page == "" {
-		query := `
-			WITH diffs AS (
-			SELECT
-				session_id,
-				EXTRACT(EPOCH FROM (timestamp - lag(timestamp) OVER (PARTITION BY session_id ORDER BY timestamp))) / 60.0 AS minutes_diff
-			FROM web_metrics
-			WHERE timestamp >= ? AND timestamp <= ?
-		), session_times AS (
-			SELECT
-				session_id,
-				SUM(CASE WHEN minutes_diff IS NOT NULL AND minutes_diff <= 5 THEN minutes_diff ELSE 0 END) AS total_time
-			FROM diffs
-			GROUP BY session_id
-		)
-		SELECT COALESCE(AVG(total_time), 0) AS avg_time_spent FROM session_times;
-		`
 
-		if err := database.Session.Raw(query, start, end).Scan(&result).Error; err != nil {
+	if where, params, ok := scope.SessionWhere(); ok {
+		query := `SELECT COALESCE(AVG(active_time), 0) AS avg_time_spent FROM sessions WHERE ` + where
+		if err := database.Reports.Raw(query, params...).Scan(&result).Error; err != nil {
 			return 0.0
 		}
-	} else {
-		query := `
+		return result.AvgTimeSpent
+	}
+
+	hits, params := scope.SessionHits()
+	query := `
 			WITH diffs AS (
 			SELECT
 				session_id,
 				EXTRACT(EPOCH FROM (timestamp - lag(timestamp) OVER (PARTITION BY session_id ORDER BY timestamp))) / 60.0 AS minutes_diff
-			FROM web_metrics
-			WHERE timestamp >= ? AND timestamp <= ? AND site = ?
+			FROM ` + hits + `
 		), session_times AS (
 			SELECT
 				session_id,
@@ -105,86 +85,138 @@ func TimeOnSite(page string, start time.Time, end time.Time) float64 {
 		)
 		SELECT COALESCE(AVG(total_time), 0) AS avg_time_spent FROM session_times;
 		`
-		if err := database.Session.Raw(query, start, end, page).Scan(&result).Error; err != nil {
-			return 0.0
-		}
+
+	if err := database.Reports.Raw(query, params...).Scan(&result).Error; err != nil {
+		return 0.0
 	}
 
 	return result.AvgTimeSpent
 }
 
 type SiteTraffic struct {
-	Page  string `json:"page"`
-	Count int    `json:"count"`
+	Page       string              `json:"page"`
+	Count      int                 `json:"count"`
+	Comparison *structs.Comparison `json:"comparison,omitempty"`
 }
 
+// GetUsersByPages counts distinct sessions per page. With compare every page
+// of either window is listed with its count in the comparison window.
 func GetUsersByPages(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	page := c.Query("page")
+	request, ok := ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
 
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse("2006-01-02", endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
+	results, err := usersByPages(request.Scope())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// default start date = 24h before end
-	start := end.Add(-24 * time.Hour)
-	if startStr != "" {
-		t, err := time.Parse("2006-01-02", startStr)
+	if scope, ok := request.ComparisonScope(); ok {
+		previous, err := usersByPages(scope)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		start = t
+		results = comparePages(results, previous)
 	}
 
-	// Build base query – you’ll need a table with at least session_id, url, time
+	c.JSON(http.StatusOK, results)
+}
+
+func usersByPages(scope Scope) ([]SiteTraffic, error) {
 	var results []SiteTraffic
-	if page == "" {
-		query := `
+	hits, params := scope.SessionHits()
+	query := `
 				SELECT page, COUNT(*) AS count
 				FROM (
 					SELECT DISTINCT session_id, page
-					FROM web_metrics
-					WHERE timestamp >= ? AND timestamp <= ?
+					FROM ` + hits + `
 				) AS t
 				GROUP BY page
 				ORDER BY count DESC;
 			`
-		if err := database.Session.Raw(query, start, end).Scan(&results).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := database.Reports.Raw(query, params...).Scan(&results).Error
+	return results, err
+}
+
+// comparePages attaches the previous counts to the current ones. Pages only
+// visited in the comparison window follow with a count of 0.
+func comparePages(current, previous []SiteTraffic) []SiteTraffic {
+	previousCounts := make(map[string]int, len(previous))
+	for _, row := range previous {
+		previousCounts[row.Page] = row.Count
+	}
+
+	seen := make(map[string]bool, len(current))
+	for i, row := range current {
+		seen[row.Page] = true
+		current[i].Comparison = compareValues(
+			map[string]float64{"count": float64(row.Count)},
+			map[string]float64{"count": float64(previousCounts[row.Page])})
+	}
+	for _, row := range previous {
+		if !seen[row.Page] {
+			current = append(current, SiteTraffic{Page: row.Page, Comparison: compareValues(
+				map[string]float64{"count": 0},
+				map[string]float64{"count": float64(row.Count)})})
+		}
+	}
+	return current
+}
+
+type ClientTraffic struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Count   int    `json:"count"`
+}
+
+// clientDimensions maps the breakdown dimensions to their name and version columns.
+var clientDimensions = map[string][2]string{
+	"browser": {"browser", "browser_version"},
+	"os":      {"os", "os_version"},
+	"device":  {"device", ""},
+	"source":  {"source", ""}, // Tracking method, not a client property, but broken down the same way
+}
+
+// GetUsersByClient returns a handler that counts distinct sessions per browser,
+// operating system, device class or tracking method. With versions=true the browser and
+// operating system breakdowns are split by major version.
+func GetUsersByClient(dimension string) gin.HandlerFunc {
+	columns := clientDimensions[dimension]
+
+	return func(c *gin.Context) {
+		request, ok := ParseParams(c, 24*time.Hour)
+		if !ok {
 			return
 		}
-	} else {
-		query := `
-				SELECT page, COUNT(*) AS count
-				FROM (
-					SELECT DISTINCT session_id, page
-					FROM web_metrics
-					WHERE timestamp >= ? AND timestamp <= ? AND site = ?
-				) AS t
-				GROUP BY page
-				ORDER BY count DESC;
-			`
-		if err := database.Session.Raw(query, start, end, page).Scan(&results).Error; err != nil {
+
+		version := "''"
+		if columns[1] != "" && c.Query("versions") == "true" {
+			version = "SPLIT_PART(" + columns[1] + ", '.', 1)"
+		}
+
+		hits, params := request.Scope().SessionHits()
+		query := database.Reports.
+			Table(hits, params...).
+			Select("COALESCE(NULLIF(" + columns[0] + ", ''), 'Unknown') AS name, " + version + " AS version, COUNT(DISTINCT session_id) AS count")
+
+		var results []ClientTraffic
+		if err := query.Group("1, 2").Order("count DESC").Scan(&results).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-	}
 
-	c.JSON(http.StatusOK, results)
+		c.JSON(http.StatusOK, results)
+	}
 }
 
 type TrafficStat struct {
-	Interval       int `json:"interval"`
-	UniqueSessions int `json:"uniqueSessions"`
-	TotalRequests  int `json:"totalRequests"`
+	Interval       int                 `json:"interval"`
+	UniqueSessions int                 `json:"uniqueSessions"`
+	TotalRequests  int                 `json:"totalRequests"`
+	Comparison     *structs.Comparison `json:"comparison,omitempty"`
 }
 
 // DB model for your traffic table
@@ -194,38 +226,47 @@ type Traffic struct {
 	Time      time.Time `gorm:"column:time"`
 }
 
+// GetTrafficStats splits the range into equal intervals. With compare the
+// comparison window is split the same way, interval i is compared with the
+// i-th interval of the comparison window.
 func GetTrafficStats(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	intervalsStr := c.DefaultQuery("intervals", "10")
-	page := c.Query("page")
-	layout := "2006-01-02"
-	// default: last 24h
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
+	request, ok := ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+	intervals, ok := IntParam(c, "intervals", 10, 1, 1000)
+	if !ok {
+		return
+	}
+	if !request.To.After(request.From) {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "to", "to must be after from")
+		return
+	}
+
+	stats, err := trafficStats(request.Scope(), intervals)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	start := end.Add(-24 * time.Hour)
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
+	if scope, ok := request.ComparisonScope(); ok {
+		previous, err := trafficStats(scope, intervals)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		start = t
+		for i := range stats {
+			stats[i].Comparison = compareValues(
+				map[string]float64{"uniqueSessions": float64(stats[i].UniqueSessions), "totalRequests": float64(stats[i].TotalRequests)},
+				map[string]float64{"uniqueSessions": float64(previous[i].UniqueSessions), "totalRequests": float64(previous[i].TotalRequests)})
+		}
 	}
 
-	intervals, err := strconv.Atoi(intervalsStr)
-	if err != nil || intervals <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Intervals must be greater than 0"})
-		return
-	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func trafficStats(scope Scope, intervals int) ([]TrafficStat, error) {
+	start, end := scope.From, scope.To
 
 	totalDuration := end.Sub(start)
 	intervalDuration := totalDuration / time.Duration(intervals)
@@ -237,16 +278,14 @@ func GetTrafficStats(c *gin.Context) {
 	}
 	var results []Result
 
-	if page == "" {
-
-		query := `
+	hits, params := scope.SessionHits()
+	query := `
 			WITH interval_data AS (
 				SELECT
 					floor(extract(epoch from (timestamp - ?)) / ?)::int as interval,
 					session_id,
 					count(*) as cnt
-				FROM web_metrics
-				WHERE timestamp >= ? AND timestamp <= ?
+				FROM ` + hits + `
 				GROUP BY interval, session_id
 			)
 			SELECT
@@ -257,35 +296,47 @@ func GetTrafficStats(c *gin.Context) {
 			GROUP BY interval
 			ORDER BY interval
 		`
+	queryParams := append([]interface{}{start, intervalDuration.Seconds()}, params...)
+
+	// With intervals as long as the session timeout a session has a page view
+	// in every interval from its first to its last one, the sessions table
+	// spares sessionizing the hits
+	if where, sessionParams, ok := scope.ActiveSessionWhere(intervalDuration); ok {
+		hitWhere, hitParams := scope.Where()
+		queryParams = append([]interface{}{start, start, intervalDuration.Seconds(), end, start, intervalDuration.Seconds()}, sessionParams...)
+		queryParams = append(append(queryParams, start, intervalDuration.Seconds()), hitParams...)
+		query = `
+			WITH interval_sessions AS (
+				SELECT interval, count(*) as unique_sessions
+				FROM (
+					SELECT generate_series(
+						floor(extract(epoch from (GREATEST(started_at, ?) - ?)) / ?)::int,
+						floor(extract(epoch from (LEAST(ended_at, ?) - ?)) / ?)::int
+					) as interval
+					FROM sessions
+					WHERE ` + where + `
+				) AS spans
+				GROUP BY interval
+			), interval_requests AS (
+				SELECT
+					floor(extract(epoch from (timestamp - ?)) / ?)::int as interval,
+					count(*) as total_requests
+				FROM web_metrics
+				WHERE ` + hitWhere + `
+				GROUP BY interval
+			)
+			SELECT
+				COALESCE(interval_sessions.interval, interval_requests.interval) as interval,
+				COALESCE(unique_sessions, 0) as unique_sessions,
+				COALESCE(total_requests, 0) as total_requests
+			FROM interval_sessions
+			FULL JOIN interval_requests ON interval_requests.interval = interval_sessions.interval
+			ORDER BY interval
+		`
+	}
 
-		if err := database.Session.Raw(query, start, intervalDuration.Seconds(), start, end).Scan(&results).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	} else {
-		query := `
-	WITH interval_data AS (
-		SELECT
-			floor(extract(epoch from (timestamp - ?)) / ?)::int as interval,
-			session_id,
-			count(*) as cnt
-		FROM web_metrics
-		WHERE timestamp >= ? AND timestamp <= ? AND site = ?
-		GROUP BY interval, session_id
-	)
-	SELECT
-		interval,
-		count(DISTINCT session_id) as unique_sessions,
-		sum(cnt) as total_requests
-	FROM interval_data
-	GROUP BY interval
-	ORDER BY interval
-`
-
-		if err := database.Session.Raw(query, start, intervalDuration.Seconds(), start, end, page).Scan(&results).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	if err := database.Reports.Raw(query, queryParams...).Scan(&results).Error; err != nil {
+		return nil, err
 	}
 
 	stats := make([]TrafficStat, intervals)
@@ -307,7 +358,7 @@ func GetTrafficStats(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, stats)
+	return stats, nil
 }
 
 type ActiveUsersResponse struct {
@@ -315,116 +366,124 @@ type ActiveUsersResponse struct {
 }
 
 func GetActiveUsers(c *gin.Context) {
-
-	page := c.Query("page")
-
-	count := ActiveUsers(page)
+	count := ActiveUsers(Scope{Site: access.SiteParam(c), Sites: access.Sites(c)})
 
 	c.JSON(http.StatusOK, ActiveUsersResponse{Count: int(count)})
 }
 
 type AvgTimeResponse struct {
-	AvgTimeSpent float64 `json:"avgTimeSpent"`
+	AvgTimeSpent float64             `json:"avgTimeSpent"`
+	Comparison   *structs.Comparison `json:"comparison,omitempty"`
 }
 
 func GetTimeOnTheSite(c *gin.Context) {
-	startStr := c.Query("from")
-	endStr := c.Query("to")
-	page := c.Query("page")
-	layout := "2006-01-02"
-
-	end := time.Now()
-	if endStr != "" {
-		t, err := time.Parse(layout, endStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
-			return
-		}
-		end = t
-	}
-
-	start := end.Add(-24 * time.Hour)
-	if startStr != "" {
-		t, err := time.Parse(layout, startStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
-			return
-		}
-		start = t
+	request, ok := ParseParams(c, 24*time.Hour)
+	if !ok {
+		return
 	}
 
-	result := TimeOnSite(page, start, end)
+	result := TimeOnSite(request.Scope())
 
 	response := AvgTimeResponse{AvgTimeSpent: result}
+	if scope, ok := request.ComparisonScope(); ok {
+		response.Comparison = NewComparison(scope,
+			map[string]float64{"avgTimeSpent": result},
+			map[string]float64{"avgTimeSpent": TimeOnSite(scope)})
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func GetBounceRate(start, end time.Time, site string) float64 {
+// bouncedSessionCondition is the HAVING clause that marks a session as bounced:
+// it has exactly one page view within the queried range.
+const bouncedSessionCondition = "COUNT(*) = 1"
+
+func GetBounceRate(scope Scope) float64 {
 	var totalSessions int64
 	var bouncedSessions int64
 
-	// Query for total sessions within the time range and optionally filtered by site
-	dbQuery := database.Session.
-		Model(&structs.WebMetric{}).
-		Where("timestamp >= ? AND timestamp <= ?", start, end)
+	if where, params, ok := scope.SessionWhere(); ok {
+		var counts struct {
+			Total   int64
+			Bounced int64
+		}
+		query := `SELECT COUNT(*) AS total, COUNT(*) FILTER (WHERE bounce) AS bounced FROM sessions WHERE ` + where
+		database.Reports.Raw(query, params...).Scan(&counts)
+		totalSessions, bouncedSessions = counts.Total, counts.Bounced
+	} else {
+		totalSessions, bouncedSessions = countBounces(scope)
+	}
 
-	if site != "" {
-		dbQuery = dbQuery.Where("site = ?", site)
+	if totalSessions == 0 {
+		return 0.0
 	}
 
-	dbQuery.Distinct("session_id").Count(&totalSessions)
+	return float64(bouncedSessions) / float64(totalSessions) * 100.0
+}
 
-	// Query for bounced sessions (sessions with only one page view)
-	// Subquery to count entries per session_id within the time range and site filter
-	subQuery := database.Session.
-		Select("session_id").
-		Table("web_metrics").
-		Where("timestamp >= ? AND timestamp <= ?", start, end)
+// countBounces counts the sessions and bounced sessions of the sessionized page views.
+func countBounces(scope Scope) (int64, int64) {
+	var totalSessions int64
+	var bouncedSessions int64
 
-	if site != "" {
-		subQuery = subQuery.Where("site = ?", site)
-	}
+	hits, params := scope.SessionHits()
+
+	// Query for total sessions within the time range and site scope
+	database.Reports.
+		Table(hits, params...).
+		Distinct("session_id").
+		Count(&totalSessions)
 
-	subQuery.
+	// Query for bounced sessions (sessions with only one page view)
+	// Subquery to count entries per session_id within the time range and site scope
+	subQuery := database.Reports.
+		Select("session_id").
+		Table(hits, params...).
 		Group("session_id").
-		Having("COUNT(*) = 1")
+		Having(bouncedSessionCondition)
 
 	// Main query to count how many distinct session_ids from the subquery exist
-	database.Session.
+	database.Reports.
 		Table("(?) as bounced", subQuery).
 		Count(&bouncedSessions)
 
-	if totalSessions == 0 {
-		return 0.0
-	}
-
-	return float64(bouncedSessions) / float64(totalSessions) * 100.0
+	return totalSessions, bouncedSessions
 }
 
-func GetCohortData(start, end time.Time, site string, numberOfWeeks int) []structs.CohortData {
+func GetCohortData(scope Scope, numberOfWeeks int) []structs.CohortData {
 	var results []structs.CohortRow
 
+	// Visitors are grouped by their client identifier, from the page views or
+	// from the materialized sessions when available
+	source, timestamp, visitor := "web_metrics", "timestamp", "session_id"
+	where, params := scope.Where()
+	if sessionWhere, sessionParams, ok := scope.SessionWhere(); ok {
+		source, timestamp, visitor = "sessions", "started_at", "visitor_id"
+		where, params = sessionWhere, sessionParams
+	}
+
+	// Weeks start on Monday in the timezone of the scope
+	timezone := scope.timezone()
 	query := `
         WITH user_first_visit AS (
             SELECT
-                session_id,
-                DATE_TRUNC('week', MIN(timestamp)) AS cohort_week
+                ` + visitor + ` AS session_id,
+                DATE_TRUNC('week', MIN(` + timestamp + ` AT TIME ZONE ?)) AS cohort_week
             FROM
-                web_metrics
+                ` + source + `
             WHERE
-                site LIKE ? AND timestamp >= ? AND timestamp <= ?
+                ` + where + `
             GROUP BY
-                session_id
+                ` + visitor + `
         ),
         weekly_activity AS (
             SELECT DISTINCT
-                session_id,
-                DATE_TRUNC('week', timestamp) AS activity_week
+                ` + visitor + ` AS session_id,
+                DATE_TRUNC('week', ` + timestamp + ` AT TIME ZONE ?) AS activity_week
             FROM
-                web_metrics
+                ` + source + `
             WHERE
-                site LIKE ? AND timestamp >= ? AND timestamp <= ?
+                ` + where + `
         ),
         cohort_activity AS (
             SELECT
@@ -449,11 +508,9 @@ func GetCohortData(start, end time.Time, site string, numberOfWeeks int) []struc
             cohort_week DESC, week_number ASC
     `
 
-	if site == "" {
-		site = "%"
-	}
-
-	if err := database.Session.Raw(query, site, start, end, site, start, end).Scan(&results).Error; err != nil {
+	queryParams := append([]interface{}{timezone}, params...)
+	queryParams = append(append(queryParams, timezone), params...)
+	if err := database.Reports.Raw(query, queryParams...).Scan(&results).Error; err != nil {
 		// Handle error
 		return nil
 	}
@@ -493,19 +550,17 @@ func GetCohortData(start, end time.Time, site string, numberOfWeeks int) []struc
 	return cohortData
 }
 
-func GetAverageJourney(start, end time.Time, site, startPageFilter, endPageFilter string) structs.SankeyData {
+func GetAverageJourney(scope Scope, startPageFilter, endPageFilter string) structs.SankeyData {
 	var flows []structs.FlowResult
 
+	hits, params := scope.SessionHits()
 	query := `
         WITH page_flows AS (
             SELECT
                 page AS source_page,
                 LEAD(page, 1) OVER (PARTITION BY session_id ORDER BY timestamp) AS target_page
             FROM
-                web_metrics
-            WHERE
-                timestamp >= ? AND timestamp <= ?
-                AND site LIKE ?
+                ` + hits + `
         )
         SELECT
             source_page,
@@ -516,7 +571,7 @@ func GetAverageJourney(start, end time.Time, site, startPageFilter, endPageFilte
         WHERE
             target_page IS NOT NULL AND source_page != target_page
     `
-	queryParams := []interface{}{start, end, site}
+	queryParams := params
 
 	if startPageFilter != "" && startPageFilter != "%" {
 		query += ` AND source_page = ?`
@@ -534,11 +589,8 @@ func GetAverageJourney(start, end time.Time, site, startPageFilter, endPageFilte
         ORDER BY
             flow_count DESC
     `
-	if site == "" {
-		site = "%"
-	}
 
-	database.Session.Raw(query, queryParams...).Scan(&flows)
+	database.Reports.Raw(query, queryParams...).Scan(&flows)
 
 	// Process flows into Sankey data
 	nodeMap := make(map[string]int)
@@ -570,20 +622,17 @@ func GetAverageJourney(start, end time.Time, site, startPageFilter, endPageFilte
 	}
 }
 
-// GetAllUniquePages retrieves all unique page URLs within a given time range and site filter.
-func GetAllUniquePages(site string, from, to time.Time) ([]string, error) {
+// GetAllUniquePages retrieves all unique page URLs within the scope.
+func GetAllUniquePages(scope Scope) ([]string, error) {
 	var pages []string
 
-	query := database.Session.
+	where, params := scope.Where()
+	err := database.Reports.
 		Model(&structs.WebMetric{}).
 		Select("DISTINCT page").
-		Where("timestamp >= ? AND timestamp <= ?", from, to)
-
-	if site != "" {
-		query = query.Where("site = ?", site)
-	}
-
-	err := query.Order("page ASC").Pluck("page", &pages).Error
+		Where(where, params...).
+		Order("page ASC").
+		Pluck("page", &pages).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to get unique pages: %w", err)
 	}
@@ -29,23 +29,31 @@ func countWeekdays(from, to time.Time) map[time.Weekday]int {
 }
 
 // GetTrafficByDayOfWeek calculates the average traffic for each day of the week.
-func GetTrafficByDayOfWeek(site string, from, to time.Time) ([]structs.TrafficByDay, error) {
+func GetTrafficByDayOfWeek(scope Scope) ([]structs.TrafficByDay, error) {
 	var results []dowResult
 	var trafficByDay []structs.TrafficByDay
 
 	dayMapping := []string{"Vasárnap", "Hétfő", "Kedd", "Szerda", "Csütörtök", "Péntek", "Szombat"}
-	weekdayCounts := countWeekdays(from, to)
-
-	query := database.Session.
-		Model(&structs.WebMetric{}).
-		Select("EXTRACT(DOW FROM timestamp) as day, COUNT(DISTINCT session_id) as count").
-		Where("timestamp BETWEEN ? AND ?", from, to)
-
-	if site != "" {
-		query = query.Where("site = ?", site)
+	timezone := scope.timezone()
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone %s: %w", timezone, err)
+	}
+	weekdayCounts := countWeekdays(scope.From.In(location), scope.To.In(location))
+
+	// A day counts the sessions started on it, days made of whole rollup
+	// buckets read the rollup
+	source, params := scope.SessionRows()
+	if rollup, ok := scope.rollupFor(time.Time{}, 24*time.Hour, location); ok {
+		if rollupSource, rollupParams, ok := scope.Rollup(rollup); ok {
+			source, params = rollupSource, rollupParams
+		}
 	}
+	query := database.Reports.
+		Table(source, params...).
+		Select("EXTRACT(DOW FROM bucket AT TIME ZONE ?) as day, SUM(sessions)::bigint as count", timezone)
 
-	err := query.Group("day").Order("day").Find(&results).Error
+	err = query.Group("day").Order("day").Find(&results).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to query traffic by day of week: %w", err)
 	}
@@ -77,25 +85,34 @@ func GetTrafficByDayOfWeek(site string, from, to time.Time) ([]structs.TrafficBy
 }
 
 // GetTrafficByHourOfDay calculates the average traffic for each hour of the day.
-func GetTrafficByHourOfDay(site string, from, to time.Time) ([]structs.TrafficByHour, error) {
+func GetTrafficByHourOfDay(scope Scope) ([]structs.TrafficByHour, error) {
 	var results []structs.TrafficByHour
 
 	// Calculate number of days in the range, rounding up. Minimum of 1.
-	numberOfDays := math.Ceil(to.Sub(from).Hours() / 24)
+	numberOfDays := math.Ceil(scope.To.Sub(scope.From).Hours() / 24)
 	if numberOfDays < 1 {
 		numberOfDays = 1
 	}
 
-	query := database.Session.
-		Model(&structs.WebMetric{}).
-		Select("EXTRACT(HOUR FROM timestamp) as hour, COUNT(DISTINCT session_id) as count").
-		Where("timestamp BETWEEN ? AND ?", from, to)
+	timezone := scope.timezone()
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone %s: %w", timezone, err)
+	}
 
-	if site != "" {
-		query = query.Where("site = ?", site)
+	// An hour counts the sessions started in it, hours made of whole rollup
+	// buckets read the rollup
+	source, params := scope.SessionRows()
+	if rollup, ok := scope.rollupFor(time.Time{}, time.Hour, location); ok {
+		if rollupSource, rollupParams, ok := scope.Rollup(rollup); ok {
+			source, params = rollupSource, rollupParams
+		}
 	}
+	query := database.Reports.
+		Table(source, params...).
+		Select("EXTRACT(HOUR FROM bucket AT TIME ZONE ?) as hour, SUM(sessions)::bigint as count", timezone)
 
-	err := query.Group("hour").Order("hour").Find(&results).Error
+	err = query.Group("hour").Order("hour").Find(&results).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to query traffic by hour of day: %w", err)
 	}
@@ -0,0 +1,31 @@
+package statistics
+
+import (
+	"net/http"
+	"statistics/sites"
+	"statistics/structs"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimezone returns the timezone dates of a request are read and
+// bucketed in: the tz parameter, else the timezone of the site, else UTC. It
+// writes the error response itself and returns false when tz is not a valid
+// IANA name.
+func RequestTimezone(c *gin.Context, site string) (string, *time.Location, bool) {
+	timezone := c.Query("tz")
+	if timezone == "" {
+		timezone = sites.DefaultTimezone
+		if site != "" {
+			timezone = sites.Timezone(site)
+		}
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		AbortWithError(c, http.StatusBadRequest, structs.ErrorCodeInvalidParameter, "tz", "Invalid timezone")
+		return "", nil, false
+	}
+	return timezone, location, true
+}
@@ -0,0 +1,50 @@
+package structs
+
+import "time"
+
+// Organization groups sites and users, e.g. the clients of an agency.
+type Organization struct {
+	Id        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"size:255;uniqueIndex"`
+	CreatedAt time.Time `gorm:"type:timestamp with time zone"`
+}
+
+// OrganizationMember gives a user a role on every site of an organization.
+type OrganizationMember struct {
+	Id             uint   `gorm:"primaryKey"`
+	OrganizationId uint   `gorm:"uniqueIndex:idx_organization_member"`
+	UserId         uint   `gorm:"uniqueIndex:idx_organization_member;index"`
+	Role           string `gorm:"size:16"` // viewer, editor or admin
+}
+
+// SiteMember gives a user a role on a single site.
+type SiteMember struct {
+	Id     uint   `gorm:"primaryKey"`
+	SiteId uint   `gorm:"uniqueIndex:idx_site_member"`
+	UserId uint   `gorm:"uniqueIndex:idx_site_member;index"`
+	Role   string `gorm:"size:16"` // viewer, editor or admin
+}
+
+// MembershipRequest is the body of the membership endpoints.
+type MembershipRequest struct {
+	UserId uint   `json:"userId"`
+	Role   string `json:"role"`
+}
+
+// OrganizationRequest is the body of the organization endpoints.
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+// UserRequest is the body of the user creation endpoint.
+type UserRequest struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Superuser bool   `json:"superuser"`
+}
+
+// SiteAccess is a site visible to the current user and the user's role on it.
+type SiteAccess struct {
+	Site string `json:"site"`
+	Role string `json:"role"`
+}
@@ -0,0 +1,26 @@
+package structs
+
+import "time"
+
+// BatchPageView is a single page view submitted to the batch ingest endpoint.
+type BatchPageView struct {
+	SessionId string     `json:"sessionId"`
+	Site      string     `json:"site"`
+	Page      string     `json:"page"`
+	Referrer  string     `json:"referrer"`  // document.referrer of the page view
+	Timestamp *time.Time `json:"timestamp"` // Client-side time of the view, defaults to the time of arrival
+}
+
+// BatchItemResult reports whether a single item of a batch was stored.
+type BatchItemResult struct {
+	Index    int    `json:"index"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchResponse is returned by the batch ingest endpoint.
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+}
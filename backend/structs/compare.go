@@ -0,0 +1,18 @@
+package structs
+
+import "time"
+
+// Comparison holds the values of a report in the comparison window selected
+// with the compare parameter, and their change against the current window.
+type Comparison struct {
+	From   *time.Time         `json:"from,omitempty"` // Set on the top level of a response, not on its rows
+	To     *time.Time         `json:"to,omitempty"`
+	Values map[string]float64 `json:"values"`
+	Delta  map[string]Delta   `json:"delta"`
+}
+
+// Delta is the change of one metric, current minus comparison value.
+type Delta struct {
+	Absolute float64  `json:"absolute"`
+	Percent  *float64 `json:"percent"` // null when the comparison value is 0
+}
@@ -0,0 +1,16 @@
+package structs
+
+// APIError is the JSON error envelope of the read endpoints. Error keeps the
+// message in the field older clients already read.
+type APIError struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`                // Machine readable, e.g. invalid_parameter
+	Parameter string `json:"parameter,omitempty"` // The offending query parameter, if any
+}
+
+// Codes of APIError
+const (
+	ErrorCodeInvalidParameter = "invalid_parameter"
+	ErrorCodeMissingParameter = "missing_parameter"
+	ErrorCodeForbidden        = "forbidden"
+)
@@ -0,0 +1,75 @@
+package structs
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// EventProperties holds the arbitrary key/value pairs of a custom event, stored as JSONB.
+type EventProperties map[string]interface{}
+
+// Value implements driver.Valuer.
+func (p EventProperties) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (p *EventProperties) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = EventProperties{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for event properties")
+	}
+	return json.Unmarshal(data, p)
+}
+
+// Event is a custom event (button click, signup, download...) fired by a tracked site.
+type Event struct {
+	Id         uint            `gorm:"primaryKey"`
+	Timestamp  time.Time       `gorm:"type:timestamp with time zone;index"`
+	Site       string          `gorm:"size:255;index"`
+	Page       string          `gorm:"size:255"`
+	SessionId  string          `gorm:"size:255;index"`
+	Name       string          `gorm:"size:255;index"`
+	Properties EventProperties `gorm:"type:jsonb;default:'{}'"`
+}
+
+// EventRequest is the body accepted by the event ingest endpoint.
+type EventRequest struct {
+	SessionId  string          `json:"sessionId"`
+	Site       string          `json:"site"`
+	Page       string          `json:"page"`
+	Name       string          `json:"name"`
+	Properties EventProperties `json:"properties"`
+	Timestamp  *time.Time      `json:"timestamp"`
+}
+
+// EventCount is the number of times an event fired and the sessions that fired it.
+type EventCount struct {
+	Name           string `json:"name"`
+	Count          int    `json:"count"`
+	UniqueSessions int    `json:"uniqueSessions"`
+}
+
+// EventPropertyBreakdown groups the occurrences of an event by the value of one property.
+type EventPropertyBreakdown struct {
+	Value          string `json:"value"`
+	Count          int    `json:"count"`
+	UniqueSessions int    `json:"uniqueSessions"`
+}
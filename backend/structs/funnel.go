@@ -0,0 +1,26 @@
+package structs
+
+// FunnelStep is one step of a funnel: a page view or a custom event.
+type FunnelStep struct {
+	Kind    string `json:"kind"`    // "page" or "event"
+	Pattern string `json:"pattern"` // Page path or event name, "*" matches any characters
+}
+
+// FunnelStepResult is the number of sessions that reached a step of a funnel.
+type FunnelStepResult struct {
+	FunnelStep
+	Sessions           int     `json:"sessions"`
+	ConversionRate     float64 `json:"conversionRate"`     // Percent of the sessions of the first step
+	StepConversionRate float64 `json:"stepConversionRate"` // Percent of the sessions of the previous step
+	DropOff            int     `json:"dropOff"`            // Sessions of the previous step that did not reach this one
+	DropOffRate        float64 `json:"dropOffRate"`
+}
+
+// Funnel is the result of a funnel analysis.
+type Funnel struct {
+	Steps          []FunnelStepResult `json:"steps"`
+	ConversionRate float64            `json:"conversionRate"` // Percent of the sessions of the first step that reached the last
+	// AverageTimeToConvert is the mean number of seconds from the first to
+	// the last step of the converted sessions, 0 without conversions.
+	AverageTimeToConvert float64 `json:"averageTimeToConvert"`
+}
@@ -0,0 +1,44 @@
+package structs
+
+import "time"
+
+// Goal is a conversion defined for a site: a visited page, a fired custom
+// event or a session lasting at least a number of minutes.
+type Goal struct {
+	Id       uint   `gorm:"primaryKey" json:"id"`
+	SiteId   uint   `gorm:"index" json:"-"`
+	Name     string `gorm:"size:255" json:"name"`
+	Kind     string `gorm:"size:16" json:"kind"`     // page, event or duration
+	Pattern  string `gorm:"size:255" json:"pattern"` // Page path or event name, "*" matches any characters
+	Duration int    `json:"duration"`                // Minutes, for duration goals
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone" json:"createdAt"`
+}
+
+// GoalRequest is the body of the goal endpoints.
+type GoalRequest struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Pattern  string `json:"pattern"`
+	Duration int    `json:"duration"`
+}
+
+// GoalConversions is the conversion report of a goal.
+type GoalConversions struct {
+	Goal           Goal               `json:"goal"`
+	Sessions       int                `json:"sessions"`
+	Conversions    int                `json:"conversions"`
+	ConversionRate float64            `json:"conversionRate"`
+	ByPage         []GoalBreakdownRow `json:"byPage"` // By landing page
+	BySource       []GoalBreakdownRow `json:"bySource"`
+	ByCountry      []GoalBreakdownRow `json:"byCountry"`
+}
+
+// GoalBreakdownRow is the conversions of the sessions sharing a landing page,
+// source or country.
+type GoalBreakdownRow struct {
+	Name           string  `json:"name"`
+	Sessions       int     `json:"sessions"`
+	Conversions    int     `json:"conversions"`
+	ConversionRate float64 `json:"conversionRate"`
+}
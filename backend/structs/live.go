@@ -0,0 +1,26 @@
+package structs
+
+import "time"
+
+// LiveSnapshot is the state of a site pushed by the live stream.
+type LiveSnapshot struct {
+	Site               string        `json:"site"`
+	ActiveUsers        int           `json:"activeUsers"`        // Sessions with a page view in the last 5 minutes
+	PageViewsPerSecond float64       `json:"pageViewsPerSecond"` // Average of the last minute
+	LatestPages        []LivePage    `json:"latestPages"`        // Newest first
+	LatestCountries    []LiveCountry `json:"latestCountries"`    // Distinct countries, newest first
+}
+
+// LivePage is a recent page view of the live stream.
+type LivePage struct {
+	Page        string    `json:"page"`
+	CountryCode string    `json:"countryCode,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// LiveCountry is a country a recent page view came from.
+type LiveCountry struct {
+	CountryCode string    `json:"countryCode"`
+	CountryName string    `json:"countryName"`
+	Timestamp   time.Time `json:"timestamp"`
+}
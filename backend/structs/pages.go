@@ -0,0 +1,16 @@
+package structs
+
+// EntryPageRow is a page sessions started on.
+type EntryPageRow struct {
+	Page       string  `json:"page"`
+	Sessions   int     `json:"sessions"`
+	BounceRate float64 `json:"bounceRate"` // Percent of these sessions that viewed no other page
+}
+
+// ExitPageRow is a page sessions ended on.
+type ExitPageRow struct {
+	Page      string  `json:"page"`
+	Exits     int     `json:"exits"`
+	PageViews int     `json:"pageViews"`
+	ExitRate  float64 `json:"exitRate"` // Percent of the views of the page that ended a session
+}
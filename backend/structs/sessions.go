@@ -0,0 +1,39 @@
+package structs
+
+import "time"
+
+// Session is a visit materialized from web_metrics by the sessions job. Page
+// views are split into sessions the same way as for the reports: a gap longer
+// than the session timeout of the site starts a new one. Bot traffic is left out.
+//
+// On TimescaleDB the primary key is (id, started_at), see migration 0002_hypertables.
+type Session struct {
+	Id             uint      `gorm:"primaryKey"`
+	VisitorId      string    `gorm:"size:255;index"` // session_id of the page views
+	Site           string    `gorm:"size:255;index:idx_sessions_site_started"`
+	StartedAt      time.Time `gorm:"type:timestamp with time zone;not null;index:idx_sessions_site_started"`
+	EndedAt        time.Time `gorm:"type:timestamp with time zone"`
+	Duration       float64   // Seconds from the first to the last page view
+	ActiveTime     float64   // Minutes, the gaps of at most 5 minutes between page views
+	PageCount      int
+	UniquePages    int
+	EntryPage      string  `gorm:"size:255"`
+	ExitPage       string  `gorm:"size:255"`
+	CountryCode    *string `gorm:"size:2"`   // Of the first page view
+	CountryName    *string `gorm:"size:255"` // Of the first page view
+	ReferrerSource *string `gorm:"size:255"` // Of the first page view
+	Bounce         bool    // A single page view
+}
+
+// SessionCursor is the progress of the sessions job, a single row.
+type SessionCursor struct {
+	Id        uint      `gorm:"primaryKey"`
+	LastHitId uint      // web_metrics rows up to this id are materialized
+	CaughtUp  bool      // The last run reached the newest page view
+	UpdatedAt time.Time `gorm:"type:timestamp with time zone"`
+
+	// Rows with a lower id than LastHitId can commit later, see sessions.step
+	RescanHitId     uint      // Runs start after this id, before LastHitId
+	CheckpointHitId uint      // LastHitId at CheckpointAt, the next RescanHitId
+	CheckpointAt    time.Time `gorm:"type:timestamp with time zone"`
+}
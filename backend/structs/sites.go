@@ -0,0 +1,43 @@
+package structs
+
+import "time"
+
+// Site is a registered tracked site. Hits for sites that are not registered
+// and enabled are rejected at ingest.
+type Site struct {
+	Id             uint   `gorm:"primaryKey" json:"id"`
+	Name           string `gorm:"size:255;uniqueIndex" json:"name"`         // Domain, as sent in the site parameter
+	IngestKey      string `gorm:"size:64;index" json:"ingestKey,omitempty"` // Secret for server-side senders and pixels
+	AllowedOrigins string `gorm:"type:text" json:"allowedOrigins"`          // Comma-separated hosts, "*.example.com" matches subdomains
+	Enabled        bool   `gorm:"not null;default:true" json:"enabled"`
+	BotPolicy      string `gorm:"size:16" json:"botPolicy"`    // "flag" or "drop", empty uses BOT_POLICY
+	OrganizationId *uint  `gorm:"index" json:"organizationId"` // Members of the organization get access to the site
+
+	// Settings
+	DisplayName    string     `gorm:"size:255" json:"displayName"`
+	Timezone       string     `gorm:"size:64;not null;default:UTC" json:"timezone"`    // IANA name, reports bucket days and hours in it
+	Currency       string     `gorm:"size:3;not null;default:EUR" json:"currency"`     // ISO 4217 code
+	ExcludedIps    string     `gorm:"type:text" json:"excludedIps"`                    // Comma-separated addresses or CIDR ranges, their hits are not stored
+	ExcludedPaths  string     `gorm:"type:text" json:"excludedPaths"`                  // Comma-separated paths, a trailing "*" matches a prefix
+	SessionTimeout int        `gorm:"not null;default:30" json:"sessionTimeout"`       // Minutes of inactivity after which a new session starts
+	ArchivedAt     *time.Time `gorm:"type:timestamp with time zone" json:"archivedAt"` // Archived sites keep their data but accept no hits
+
+	CreatedAt time.Time `gorm:"type:timestamp with time zone" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"type:timestamp with time zone" json:"updatedAt"`
+}
+
+// SiteRequest is the body of the site create and update endpoints. Fields left
+// out keep their current value.
+type SiteRequest struct {
+	Name           *string `json:"name"`
+	DisplayName    *string `json:"displayName"`
+	Timezone       *string `json:"timezone"`
+	Currency       *string `json:"currency"`
+	AllowedOrigins *string `json:"allowedOrigins"`
+	ExcludedIps    *string `json:"excludedIps"`
+	ExcludedPaths  *string `json:"excludedPaths"`
+	SessionTimeout *int    `json:"sessionTimeout"`
+	Enabled        *bool   `json:"enabled"`
+	BotPolicy      *string `json:"botPolicy"`
+	OrganizationId *uint   `json:"organizationId"`
+}
@@ -0,0 +1,31 @@
+package structs
+
+import "time"
+
+// StorageStatus reports how the raw page views of web_metrics are stored.
+type StorageStatus struct {
+	Timescale         bool         `json:"timescale"`                   // The TimescaleDB extension is installed
+	Version           string       `json:"version,omitempty"`           // Of the extension
+	Hypertable        bool         `json:"hypertable"`                  // web_metrics is a hypertable
+	Chunks            int          `json:"chunks"`                      // Partitions of the hypertable
+	CompressedChunks  int          `json:"compressedChunks"`            // Partitions stored compressed
+	CompressAfter     *string      `json:"compressAfter"`               // Age of the chunks the compression policy compresses, null without policy
+	Retention         *string      `json:"retention"`                   // Age of the chunks the retention policy drops, null to keep everything
+	TotalBytes        int64        `json:"totalBytes"`                  // Table, indexes and chunks
+	UncompressedBytes *int64       `json:"uncompressedBytes,omitempty"` // Of the compressed chunks before compression
+	CompressedBytes   *int64       `json:"compressedBytes,omitempty"`   // Of the compressed chunks
+	Rollups           string       `json:"rollups"`                     // continuous or table, see database.RollupStorage
+	Indexes           []string     `json:"indexes"`
+	Jobs              []StorageJob `json:"jobs"`
+}
+
+// StorageJob is a background policy job of TimescaleDB on web_metrics or a rollup.
+type StorageJob struct {
+	Id            int        `json:"id"`
+	Kind          string     `json:"kind"`  // policy_compression, policy_retention or policy_refresh_continuous_aggregate
+	Target        string     `json:"table"` // web_metrics or the rollup
+	LastRunStatus *string    `json:"lastRunStatus"`
+	LastRunAt     *time.Time `json:"lastRunAt"`
+	NextStartAt   *time.Time `json:"nextStartAt"`
+	TotalFailures int        `json:"totalFailures"`
+}
@@ -5,12 +5,13 @@ import (
 )
 
 type WebMetric struct {
+	// On TimescaleDB the primary key is (id, timestamp), see migration 0002_hypertables
 	Id        uint      `gorm:"primaryKey"`
-	Timestamp time.Time `gorm:"type:timestamp with time zone"`
+	Timestamp time.Time `gorm:"type:timestamp with time zone;not null;index:idx_web_metrics_site_timestamp,priority:2;index:idx_web_metrics_session_timestamp,priority:2"`
 	Page      string    `gorm:"size:255"`
-	Site      string    `gorm:"size:255"`
+	Site      string    `gorm:"size:255;index:idx_web_metrics_site_timestamp,priority:1"`
 	Ip        string    `gorm:"size:255"`
-	SessionId string    `gorm:"size:255"`
+	SessionId string    `gorm:"size:255;index:idx_web_metrics_session_timestamp,priority:1"`
 
 	// Geolocation fields (nullable for graceful degradation)
 	CountryCode *string  `gorm:"size:2"`              // ISO 3166-1 alpha-2 (e.g., "US", "GB")
@@ -19,8 +20,37 @@ type WebMetric struct {
 	Region      *string  `gorm:"size:255"`            // Region/State
 	Latitude    *float64 `gorm:"type:decimal(10,8)"` // Coordinate precision
 	Longitude   *float64 `gorm:"type:decimal(11,8)"` // Coordinate precision
+
+	// Acquisition fields, reports attribute a session to the values of its first hit
+	Referrer       *string `gorm:"size:2048"` // Full referrer URL
+	ReferrerSource *string `gorm:"size:255"`  // Normalized referrer domain (e.g., "google.com")
+	UtmSource      *string `gorm:"size:255"`
+	UtmMedium      *string `gorm:"size:255"`
+	UtmCampaign    *string `gorm:"size:255"`
+	UtmTerm        *string `gorm:"size:255"`
+	UtmContent     *string `gorm:"size:255"`
+
+	// Client fields parsed from the User-Agent header
+	Browser        string `gorm:"size:64"`
+	BrowserVersion string `gorm:"size:32"`
+	Os             string `gorm:"size:64"`
+	OsVersion      string `gorm:"size:32"`
+	Device         string `gorm:"size:16"` // desktop, mobile, tablet or bot
+
+	// Tracking method the hit arrived through: script, batch or pixel
+	Source string `gorm:"size:16"`
+
+	// Bot traffic is stored only when the site's bot policy is "flag"; statistics exclude it
+	IsBot bool `gorm:"not null;default:false"`
 }
 
+// Values of WebMetric.Source
+const (
+	SourceScript = "script"
+	SourceBatch  = "batch"
+	SourcePixel  = "pixel"
+)
+
 type QueryResult struct {
 	traffic int `gorm:"column:traffic"`
 }
@@ -38,10 +68,18 @@ type LocationQueryResult struct{
 	UserCount int `gorm:"column:user_count"`
 }
 
-type BounceRateResponse struct {
+// AcquisitionRow is one row of the source, medium or campaign report.
+type AcquisitionRow struct {
+	Name       string  `json:"name"`
+	Sessions   int     `json:"sessions"`
 	BounceRate float64 `json:"bounceRate"`
 }
 
+type BounceRateResponse struct {
+	BounceRate float64     `json:"bounceRate"`
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
 type AvgTimeResponse struct {
 
 	AvgTimeSpent float64 `json:"avgTimeSpent"`
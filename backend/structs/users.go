@@ -0,0 +1,38 @@
+package structs
+
+import "time"
+
+// User is a dashboard user allowed to read the statistics API.
+type User struct {
+	Id           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"size:255;uniqueIndex" json:"username"`
+	PasswordHash string    `gorm:"size:255" json:"-"`
+	Superuser    bool      `gorm:"not null;default:false" json:"superuser"` // Admin of every site and organization
+	CreatedAt    time.Time `gorm:"type:timestamp with time zone" json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"type:timestamp with time zone" json:"-"`
+}
+
+// LoginRequest is the body of the login endpoint.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest is the body of the token refresh endpoint.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse carries a freshly issued token pair.
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // Lifetime of the access token in seconds
+}
+
+// StreamTokenResponse carries a token opening the live stream of a site.
+type StreamTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expiresIn"` // Seconds left to open the stream with it
+}
@@ -0,0 +1,34 @@
+package tracker
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version of the served tracker, bump it together with the header of tracker.js.
+const Version = "1.2.0"
+
+//go:embed tracker.js
+var script []byte
+
+var etag = func() string {
+	sum := sha256.Sum256(script)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}()
+
+// Serve answers with the embedded tracker script.
+func Serve(c *gin.Context) {
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("ETag", etag)
+	c.Header("X-Tracker-Version", Version)
+	c.Data(http.StatusOK, "application/javascript; charset=utf-8", script)
+}
@@ -0,0 +1,170 @@
+/*! web-statistics tracker v1.2.0 */
+(function (window, document) {
+  "use strict";
+
+  var VERSION = "1.2.0";
+  var SESSION_KEY = "ws_session";
+  // The backend splits sessions by the session timeout of the site, the ID is
+  // only renewed after the longest timeout a site can set, a day without page views
+  var ID_LIFETIME = 24 * 60 * 60 * 1000;
+  var CAMPAIGN_PARAMETERS = ["utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"];
+
+  var script = document.currentScript;
+  if (!script || window.webStatistics && window.webStatistics.version) {
+    return;
+  }
+
+  // The script is served from <PREFIX>/tracker.js, the API lives under the same prefix
+  var endpoint = script.src.replace(/\/tracker(\/v\d+)?\.js(\?.*)?$/, "");
+  var site = script.getAttribute("data-site") || window.location.hostname;
+  var autoTrack = script.getAttribute("data-auto") !== "false";
+  var key = script.getAttribute("data-key"); // Only needed when the origin is not on the site's allowlist
+  var lastPage = null;
+  var firstView = true;
+
+  function generateId() {
+    if (window.crypto && window.crypto.randomUUID) {
+      return window.crypto.randomUUID();
+    }
+    return "xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx".replace(/[xy]/g, function (c) {
+      var r = (Math.random() * 16) | 0;
+      return (c === "x" ? r : (r & 0x3) | 0x8).toString(16);
+    });
+  }
+
+  // sessionId returns the current session ID, a new one after ID_LIFETIME.
+  // Storage can be unavailable (private mode, blocked cookies), then the ID lives in memory.
+  var memorySession = null;
+  function sessionId() {
+    var now = Date.now();
+    var session = memorySession;
+    try {
+      session = JSON.parse(window.localStorage.getItem(SESSION_KEY)) || session;
+    } catch (e) {}
+
+    if (!session || !session.id || now - session.last > ID_LIFETIME) {
+      session = { id: generateId(), last: now };
+    }
+    session.last = now;
+
+    memorySession = session;
+    try {
+      window.localStorage.setItem(SESSION_KEY, JSON.stringify(session));
+    } catch (e) {}
+    return session.id;
+  }
+
+  function send(url, body) {
+    if (navigator.sendBeacon) {
+      // text/plain keeps the beacon a simple request, so no CORS preflight is needed
+      var payload = body ? new Blob([body], { type: "text/plain" }) : null;
+      if (navigator.sendBeacon(url, payload)) {
+        return;
+      }
+    }
+    if (window.fetch) {
+      window.fetch(url, {
+        method: body ? "POST" : "GET",
+        body: body,
+        keepalive: true,
+        credentials: "omit",
+      }).catch(function () {});
+      return;
+    }
+    var request = new XMLHttpRequest();
+    request.open(body ? "POST" : "GET", url, true);
+    request.send(body || null);
+  }
+
+  // currentPage is the path alone, query strings (campaign tags, click ids)
+  // would split the reports of a page.
+  function currentPage() {
+    return window.location.pathname;
+  }
+
+  // campaignParams returns the UTM parameters of a query string, still encoded.
+  function campaignParams(search) {
+    var params = [];
+    for (var i = 0; i < CAMPAIGN_PARAMETERS.length; i++) {
+      var match = new RegExp("[?&]" + CAMPAIGN_PARAMETERS[i] + "=([^&#]*)").exec(search);
+      if (match && match[1]) {
+        params.push(CAMPAIGN_PARAMETERS[i] + "=" + match[1]);
+      }
+    }
+    return params;
+  }
+
+  // pageview records a page view, repeated calls for the same page are ignored.
+  // The query string of the page, or else of the location, only passes its
+  // campaign parameters.
+  function pageview(page) {
+    var search = window.location.search;
+    if (page && page.indexOf("?") >= 0) {
+      search = page.slice(page.indexOf("?"));
+      page = page.slice(0, page.indexOf("?"));
+    }
+    page = page || currentPage();
+    if (page === lastPage) {
+      return;
+    }
+    lastPage = page;
+
+    var params = ["sessionId=" + encodeURIComponent(sessionId()),
+      "site=" + encodeURIComponent(site),
+      "page=" + encodeURIComponent(page)].concat(campaignParams(search));
+    if (firstView && document.referrer) {
+      params.push("ref=" + encodeURIComponent(document.referrer));
+    }
+    firstView = false;
+
+    if (key) {
+      params.push("key=" + encodeURIComponent(key));
+    }
+
+    send(endpoint + "/put-traffic?" + params.join("&"));
+  }
+
+  // track records a custom event with optional key/value properties.
+  function track(event, props) {
+    if (!event) {
+      return;
+    }
+    send(endpoint + "/put-event" + (key ? "?key=" + encodeURIComponent(key) : ""), JSON.stringify({
+      sessionId: sessionId(),
+      site: site,
+      page: currentPage(),
+      name: String(event),
+      properties: props || {},
+    }));
+  }
+
+  function onRouteChange() {
+    // Let the router update the location before reading it
+    window.setTimeout(function () { pageview(); }, 0);
+  }
+
+  function wrapHistory(method) {
+    var original = window.history[method];
+    if (!original) {
+      return;
+    }
+    window.history[method] = function () {
+      var result = original.apply(this, arguments);
+      onRouteChange();
+      return result;
+    };
+  }
+
+  window.webStatistics = {
+    version: VERSION,
+    pageview: pageview,
+    track: track,
+  };
+
+  if (autoTrack) {
+    wrapHistory("pushState");
+    wrapHistory("replaceState");
+    window.addEventListener("popstate", onRouteChange);
+    pageview();
+  }
+})(window, document);
@@ -0,0 +1,110 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Device classes stored on WebMetric.Device
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Info is the parsed form of a User-Agent header.
+type Info struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string
+}
+
+type pattern struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// botPattern matches the self-identifying crawlers, HTTP libraries and headless browsers.
+var botPattern = regexp.MustCompile(`(?i)bot\b|bot/|crawl|spider|slurp|mediapartners|facebookexternalhit|embedly|preview|headless|phantomjs|puppeteer|playwright|selenium|lighthouse|pingdom|uptime|monitor|curl/|wget/|python-requests|python-urllib|aiohttp|go-http-client|java/|okhttp|axios/|node-fetch|libwww|httpclient|scrapy`)
+
+// browserPatterns are checked in order, because most browsers also claim to be Chrome or Safari.
+var browserPatterns = []pattern{
+	{"Edge", regexp.MustCompile(`(?:Edg|EdgA|EdgiOS|Edge)/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Yandex", regexp.MustCompile(`YaBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+}
+
+var osPatterns = []pattern{
+	{"Windows", regexp.MustCompile(`Windows NT ([\d.]+)`)},
+	{"iOS", regexp.MustCompile(`(?:iPhone|iPad|iPod).*? OS ([\d_]+)`)},
+	{"macOS", regexp.MustCompile(`Mac OS X ([\d_.]+)`)},
+	{"Android", regexp.MustCompile(`Android ([\d.]+)`)},
+	{"Chrome OS", regexp.MustCompile(`CrOS \S+ ([\d.]+)`)},
+	{"Linux", regexp.MustCompile(`Linux()`)},
+}
+
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// Unknown is the Info of a client that could not be classified.
+func Unknown() Info {
+	return Info{Browser: "Unknown", OS: "Unknown", Device: DeviceDesktop}
+}
+
+// Parse extracts the browser, operating system and device class from a User-Agent header.
+// An empty header is classified as a bot, real browsers always send one.
+func Parse(ua string) Info {
+	info := Unknown()
+
+	ua = strings.TrimSpace(ua)
+	if ua == "" || botPattern.MatchString(ua) {
+		info.Browser = "Bot"
+		info.Device = DeviceBot
+		return info
+	}
+
+	for _, p := range browserPatterns {
+		if match := p.regex.FindStringSubmatch(ua); match != nil {
+			info.Browser = p.name
+			info.BrowserVersion = match[1]
+			break
+		}
+	}
+
+	for _, p := range osPatterns {
+		if match := p.regex.FindStringSubmatch(ua); match != nil {
+			info.OS = p.name
+			info.OSVersion = strings.ReplaceAll(match[1], "_", ".")
+			break
+		}
+	}
+	if info.OS == "Windows" {
+		if version, ok := windowsVersions[info.OSVersion]; ok {
+			info.OSVersion = version
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(info.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		info.Device = DeviceMobile
+	}
+
+	return info
+}
@@ -0,0 +1,100 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "empty",
+			ua:   "",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "Googlebot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "Bingbot",
+			ua:   "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "headless Chrome",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "Python requests",
+			ua:   "python-requests/2.31.0",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "link preview",
+			ua:   "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			want: Info{Browser: "Bot", OS: "Unknown", Device: DeviceBot},
+		},
+		{
+			name: "Chrome on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Windows", OSVersion: "10", Device: DeviceDesktop},
+		},
+		{
+			name: "Edge claims Chrome",
+			ua:   "Mozilla/5.0 (Windows NT 6.1; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36 Edg/109.0.1518.78",
+			want: Info{Browser: "Edge", BrowserVersion: "109.0.1518.78", OS: "Windows", OSVersion: "7", Device: DeviceDesktop},
+		},
+		{
+			name: "Firefox on Linux",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Info{Browser: "Firefox", BrowserVersion: "121.0", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			name: "Safari on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			want: Info{Browser: "Safari", BrowserVersion: "17.2", OS: "macOS", OSVersion: "10.15.7", Device: DeviceDesktop},
+		},
+		{
+			name: "Safari on iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", OSVersion: "17.2", Device: DeviceMobile},
+		},
+		{
+			name: "Chrome on an Android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.6099.144", OS: "Android", OSVersion: "14", Device: DeviceMobile},
+		},
+		{
+			name: "Android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X200) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36",
+			want: Info{Browser: "Samsung Internet", BrowserVersion: "23.0", OS: "Android", OSVersion: "13", Device: DeviceTablet},
+		},
+		{
+			name: "iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			want: Info{Browser: "Chrome", BrowserVersion: "120.0.6099.119", OS: "iOS", OSVersion: "16.6", Device: DeviceTablet},
+		},
+		{
+			name: "unknown client",
+			ua:   "SomeApp",
+			want: Info{Browser: "Unknown", OS: "Unknown", Device: DeviceDesktop},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,18 @@
 
 import { Suspense } from 'react';
 import Home from '@/components/Home/Home.component';
+import Login from '@/components/Login/Login.component';
+import { useLoggedIn } from '@/utils/auth';
 
 export default function Page() {
+  const loggedIn = useLoggedIn();
+
+  if (loggedIn === null) {
+    return <div>Loading...</div>;
+  }
+  if (!loggedIn) {
+    return <Login />;
+  }
   return (
     <Suspense fallback={<div>Loading...</div>}>
       <Home />
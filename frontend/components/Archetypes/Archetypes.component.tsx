@@ -2,6 +2,7 @@
 import { useEffect, useState } from "react";
 import { Card, Row, Col, List, Tag, Spin, Alert, Empty } from "antd";
 import { UserOutlined, ClockCircleOutlined, RetweetOutlined, AimOutlined } from "@ant-design/icons";
+import { apiFetch } from "@/utils/auth";
 
 // --- Types ---
 interface ArchetypeCharacteristic {
@@ -47,7 +48,7 @@ const Archetypes = ({ site, from, to }: ArchetypesProps) => {
     const toDate = to ? `&to=${to.toISOString().split("T")[0]}` : "";
     const siteFilter = site ? `&site=${site}` : "";
 
-    fetch(`/api/v1/statistics/archetypes?${siteFilter}${fromDate}${toDate}`)
+    apiFetch(`/api/v1/statistics/archetypes?${siteFilter}${fromDate}${toDate}`)
       .then((response) => {
         if (!response.ok) {
           throw new Error("Network response was not ok");
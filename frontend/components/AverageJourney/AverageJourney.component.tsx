@@ -16,6 +16,7 @@ import "reactflow/dist/style.css";
 import dagre from "dagre";
 import { Spin, Alert, Empty, Select } from "antd";
 import { TeamOutlined } from "@ant-design/icons";
+import { apiFetch } from "@/utils/auth";
 
 // --- TÍPUSOK ---
 interface ApiNode {
@@ -149,7 +150,7 @@ const AverageJourney = ({
     const fromParam = fromStr ? `&from=${fromStr}` : "";
     const toParam = toStr ? `&to=${toStr}` : "";
 
-    fetch(`/api/v1/statistics/unique-pages?${siteFilter}${fromParam}${toParam}`)
+    apiFetch(`/api/v1/statistics/unique-pages?${siteFilter}${fromParam}${toParam}`)
       .then((res) => {
         if (!res.ok) throw new Error("API Hiba: Unique Pages");
         return res.json();
@@ -181,7 +182,7 @@ const AverageJourney = ({
     const startPageParam = startPageFilter ? `&start_page=${encodeURIComponent(startPageFilter)}` : "";
     const endPageParam = endPageFilter ? `&end_page=${encodeURIComponent(endPageFilter)}` : "";
 
-    fetch(`/api/v1/average-journey?${siteFilter}${fromParam}${toParam}${startPageParam}${endPageParam}`, {
+    apiFetch(`/api/v1/average-journey?${siteFilter}${fromParam}${toParam}${startPageParam}${endPageParam}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -18,6 +18,7 @@ import {
   ResponsiveContainer,
   Legend,
 } from "recharts";
+import { apiFetch } from "@/utils/auth";
 
 interface CohortData {
   cohort_date: string;
@@ -107,7 +108,7 @@ const CohortAnalysis = ({
     const toDate = to ? `&to=${to.toISOString().split("T")[0]}` : "";
     const siteFilter = site ? `&site=${site}` : "";
 
-    fetch(
+    apiFetch(
       `/api/v1/cohort?weeks=${numberOfWeeks}${siteFilter}${fromDate}${toDate}`,
       {
         method: "POST",
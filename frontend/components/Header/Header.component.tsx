@@ -1,7 +1,9 @@
 "use client";
-import { Row, Col, Typography, Select, DatePicker } from "antd";
+import { Row, Col, Typography, Select, DatePicker, Button } from "antd";
+import { LogoutOutlined } from "@ant-design/icons";
 import { useSearchParams, useRouter } from "next/navigation";
 import Image from "next/image";
+import { logout } from "@/utils/auth";
 
 const { RangePicker } = DatePicker;
 const { Title } = Typography;
@@ -43,9 +45,9 @@ export default function Header({
             </Col>
           </Row>
         </Col>
-        <Col xs={24} sm={24} md={12}>
+        <Col xs={24} sm={24} md={14}>
           <Row gutter={[16, 16]} justify="end">
-            <Col xs={24} sm={12}>
+            <Col xs={24} sm={10}>
               <Select
                 style={{ width: "100%" }}
                 placeholder="Válassz webhelyet"
@@ -61,7 +63,7 @@ export default function Header({
                 }}
               />
             </Col>
-            <Col xs={24} sm={12}>
+            <Col xs={24} sm={10}>
               <RangePicker
                 style={{ width: "100%" }}
                 onChange={(dates: any) => {
@@ -73,6 +75,11 @@ export default function Header({
                 }}
               />
             </Col>
+            <Col xs={24} sm={4}>
+              <Button block icon={<LogoutOutlined />} onClick={logout}>
+                Kilépés
+              </Button>
+            </Col>
           </Row>
         </Col>
       </Row>
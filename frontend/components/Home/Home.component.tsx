@@ -36,6 +36,7 @@ import CohortAnalysis from "../CohortAnalysis/CohortAnalysis.component";
 import AverageJourney from "../AverageJourney/AverageJourney.component";
 import TimeAnalysis from "../TimeAnalysis/TimeAnalysis.component";
 import Archetypes from "../Archetypes/Archetypes.component";
+import { apiFetch } from "@/utils/auth";
 const { Content } = Layout;
 const { Title } = Typography;
 
@@ -62,7 +63,7 @@ export default function Home() {
   const [bounceRateYesterday, setBounceRateYesterday] = useState(0);
 
   useEffect(() => {
-    fetch("/api/v1/get-sites", {
+    apiFetch("/api/v1/get-sites", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -73,7 +74,7 @@ export default function Home() {
 
   useEffect(() => {
     const fetchActiveUsers = () => {
-      fetch(`/api/v1/active?page=${selectedSite}`, {
+      apiFetch(`/api/v1/active?page=${selectedSite}`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
       })
@@ -112,7 +113,7 @@ export default function Home() {
     }
 
     // visitors
-    fetch(`/api/v1/traffic?page=${selectedSite}${from}${to}`, {
+    apiFetch(`/api/v1/traffic?page=${selectedSite}${from}${to}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -120,7 +121,7 @@ export default function Home() {
       .then((data) => setVisitors(data.traffic || 0))
       .catch((error) => console.error("Error fetching stats:", error));
 
-    fetch(
+    apiFetch(
       `/api/v1/traffic?page=${selectedSite}${fromYesterday}${toYesterday}`,
       {
         method: "POST",
@@ -132,7 +133,7 @@ export default function Home() {
       .catch((error) => console.error("Error fetching stats:", error));
 
     // chart
-    fetch(
+    apiFetch(
       `/api/v1/graph?page=${selectedSite}&intervals=${
         fromDate && toDate
           ? Math.ceil(
@@ -151,7 +152,7 @@ export default function Home() {
       .then((data) => setVisitToChart(data || []))
       .catch((error) => console.error("Error fetching stats:", error));
 
-    fetch(`/api/v1/time?page=${selectedSite}${from}${to}`, {
+    apiFetch(`/api/v1/time?page=${selectedSite}${from}${to}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -159,7 +160,7 @@ export default function Home() {
       .then((data) => setSpentTime(data.avgTimeSpent || 0))
       .catch((error) => console.error("Error fetching stats:", error));
 
-    fetch(`/api/v1/time?page=${selectedSite}${fromYesterday}${toYesterday}`, {
+    apiFetch(`/api/v1/time?page=${selectedSite}${fromYesterday}${toYesterday}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -167,7 +168,7 @@ export default function Home() {
       .then((data) => setSpentTimeYesterday(data.avgTimeSpent || 0))
       .catch((error) => console.error("Error fetching stats:", error));
 
-    fetch(`/api/v1/sites?page=${selectedSite}${from}${to}`, {
+    apiFetch(`/api/v1/sites?page=${selectedSite}${from}${to}`, {
       method: "POST",
       headers: { "Content-Type": "application/json" },
     })
@@ -175,7 +176,7 @@ export default function Home() {
       .then((data) => setSitesTraffic(data || []))
       .catch((error) => console.error("Error fetching stats:", error));
 
-    fetch(`/api/v1/bounce-rate?site=${selectedSite}${from}${to}`, {
+    apiFetch(`/api/v1/bounce-rate?site=${selectedSite}${from}${to}`, {
       method: "GET",
       headers: { "Content-Type": "application/json" },
     })
@@ -183,7 +184,7 @@ export default function Home() {
       .then((data) => setBounceRate(data.bounceRate || 0))
       .catch((error) => console.error("Error fetching bounce rate:", error));
 
-    fetch(
+    apiFetch(
       `/api/v1/bounce-rate?site=${selectedSite}${fromYesterday}${toYesterday}`,
       {
         method: "GET",
@@ -0,0 +1,69 @@
+"use client";
+import { useState } from "react";
+import { Alert, Button, Card, Form, Input, Layout, Typography } from "antd";
+import { LockOutlined, UserOutlined } from "@ant-design/icons";
+import Image from "next/image";
+import { login } from "@/utils/auth";
+
+const { Title } = Typography;
+
+export default function Login() {
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState("");
+
+  const onFinish = async (values: { username: string; password: string }) => {
+    setLoading(true);
+    setError("");
+    try {
+      await login(values.username, values.password);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Sikertelen bejelentkezés");
+      setLoading(false);
+    }
+  };
+
+  return (
+    <Layout
+      style={{
+        minHeight: "100vh",
+        alignItems: "center",
+        justifyContent: "center",
+        background: "#f0f2f5",
+      }}
+    >
+      <Card style={{ width: 360 }}>
+        <div style={{ textAlign: "center", marginBottom: 24 }}>
+          <Image src="/logo.png" alt="logo" width={48} height={48} />
+          <Title level={4} style={{ marginTop: 12, marginBottom: 0 }}>
+            Statisztikák
+          </Title>
+        </div>
+        {error && (
+          <Alert type="error" message={error} style={{ marginBottom: 16 }} />
+        )}
+        <Form layout="vertical" onFinish={onFinish} requiredMark={false}>
+          <Form.Item
+            name="username"
+            label="Felhasználónév"
+            rules={[{ required: true, message: "Add meg a felhasználóneved" }]}
+          >
+            <Input prefix={<UserOutlined />} autoComplete="username" />
+          </Form.Item>
+          <Form.Item
+            name="password"
+            label="Jelszó"
+            rules={[{ required: true, message: "Add meg a jelszavad" }]}
+          >
+            <Input.Password
+              prefix={<LockOutlined />}
+              autoComplete="current-password"
+            />
+          </Form.Item>
+          <Button type="primary" htmlType="submit" block loading={loading}>
+            Bejelentkezés
+          </Button>
+        </Form>
+      </Card>
+    </Layout>
+  );
+}
@@ -3,6 +3,7 @@ import React, { useEffect, useMemo, useState } from "react";
 import dynamic from "next/dynamic";
 import "leaflet/dist/leaflet.css";
 import type * as Leaflet from "leaflet";
+import { apiFetch } from "@/utils/auth";
 
 interface LocationData {
   City: string;
@@ -145,7 +146,7 @@ const MapComponent = ({
 
     const fetchLocations = async () => {
       try {
-        const res = await fetch(
+        const res = await apiFetch(
           `/api/v1/get-locations?page=${site}${from ? `&from=${from.toISOString().split("T")[0]}` : ""}${
             to ? `&to=${to.toISOString().split("T")[0]}` : ""
           }`,
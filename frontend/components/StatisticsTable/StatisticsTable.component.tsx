@@ -2,6 +2,7 @@
 import React, { useEffect, useState } from "react";
 import { Table } from "antd";
 import type { TableProps } from 'antd';
+import { apiFetch } from "@/utils/auth";
 
 interface LocationData {
   City: string;
@@ -43,7 +44,7 @@ const StatisticsTable = ({
 
     const fetchLocations = async () => {
       try {
-        const res = await fetch(
+        const res = await apiFetch(
           `/api/v1/get-locations?page=${site}${from ? `&from=${from.toISOString().split("T")[0]}` : ""}${
             to ? `&to=${to.toISOString().split("T")[0]}` : ""
           }`,
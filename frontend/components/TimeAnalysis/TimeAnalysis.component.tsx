@@ -14,6 +14,7 @@ import {
   AreaChart,
   Area,
 } from "recharts";
+import { apiFetch } from "@/utils/auth";
 
 
 
@@ -42,7 +43,7 @@ const TimeAnalysis = ({ site, from, to }: TimeAnalysisProps) => {
     const toDate = to ? `&to=${to.toISOString().split("T")[0]}` : "";
 
     // Fetch traffic by day of week
-    fetch(
+    apiFetch(
       `/api/v1/statistics/traffic-by-day-of-week?site=${site}${fromDate}${toDate}`,
     )
       .then((response) => response.json())
@@ -52,7 +53,7 @@ const TimeAnalysis = ({ site, from, to }: TimeAnalysisProps) => {
       );
 
     // Fetch traffic by hour of day
-    fetch(
+    apiFetch(
       `/api/v1/statistics/traffic-by-hour-of-day?site=${site}${fromDate}${toDate}`,
     )
       .then((response) => response.json())
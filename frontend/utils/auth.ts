@@ -0,0 +1,128 @@
+"use client";
+import { useEffect, useState } from "react";
+
+// The read API needs a bearer token. The token pair of the login is kept in
+// localStorage, an expired access token is renewed with the refresh token.
+
+const storageKey = "statistics.auth";
+const changeEvent = "statistics-auth-change";
+
+interface Tokens {
+  accessToken: string;
+  refreshToken: string;
+}
+
+function readTokens(): Tokens | null {
+  if (typeof window === "undefined") return null;
+  try {
+    const stored = window.localStorage.getItem(storageKey);
+    return stored ? (JSON.parse(stored) as Tokens) : null;
+  } catch {
+    return null;
+  }
+}
+
+function storeTokens(tokens: Tokens | null) {
+  if (tokens) {
+    window.localStorage.setItem(
+      storageKey,
+      JSON.stringify({
+        accessToken: tokens.accessToken,
+        refreshToken: tokens.refreshToken,
+      }),
+    );
+  } else {
+    window.localStorage.removeItem(storageKey);
+  }
+  window.dispatchEvent(new Event(changeEvent));
+}
+
+export async function login(username: string, password: string) {
+  const response = await fetch("/api/v1/auth/login", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ username, password }),
+  });
+  if (response.status === 401) {
+    throw new Error("Hibás felhasználónév vagy jelszó");
+  }
+  if (!response.ok) {
+    throw new Error(`Sikertelen bejelentkezés (HTTP ${response.status})`);
+  }
+  storeTokens(await response.json());
+}
+
+export function logout() {
+  storeTokens(null);
+}
+
+// A single refresh is shared by the requests failing at the same time.
+let refreshing: Promise<boolean> | null = null;
+
+function refresh(): Promise<boolean> {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const tokens = readTokens();
+      if (!tokens) return false;
+      try {
+        const response = await fetch("/api/v1/auth/refresh", {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refreshToken: tokens.refreshToken }),
+        });
+        if (!response.ok) return false;
+        storeTokens(await response.json());
+        return true;
+      } catch {
+        return false;
+      }
+    })().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+function withToken(init: RequestInit | undefined): RequestInit {
+  const headers = new Headers(init?.headers);
+  const tokens = readTokens();
+  if (tokens) {
+    headers.set("Authorization", `Bearer ${tokens.accessToken}`);
+  }
+  return { ...init, headers };
+}
+
+// apiFetch is fetch with the access token. On 401 it refreshes the tokens and
+// retries once, and logs out when that fails too.
+export async function apiFetch(input: string, init?: RequestInit) {
+  let response = await fetch(input, withToken(init));
+  if (response.status !== 401) return response;
+
+  if (await refresh()) {
+    response = await fetch(input, withToken(init));
+  }
+  if (response.status === 401) {
+    logout();
+  }
+  return response;
+}
+
+// useLoggedIn reports whether tokens are stored, null until it is known on
+// the client.
+export function useLoggedIn() {
+  const [loggedIn, setLoggedIn] = useState<boolean | null>(null);
+
+  useEffect(() => {
+    const update = () => setLoggedIn(readTokens() !== null);
+    update();
+    window.addEventListener(changeEvent, update);
+    // Logging in or out in another tab
+    window.addEventListener("storage", update);
+    return () => {
+      window.removeEventListener(changeEvent, update);
+      window.removeEventListener("storage", update);
+    };
+  }, []);
+
+  return loggedIn;
+}